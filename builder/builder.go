@@ -1,8 +1,12 @@
 package builder
 
 import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/contextgg/go-es/es"
 	"github.com/contextgg/go-es/es/basic"
@@ -54,35 +58,57 @@ func Event(source interface{}, islocal bool) *EventConfig {
 }
 
 // LocalStore used for testing
-func LocalStore() DataStoreFactory {
+func LocalStore(opts ...basic.Option) DataStoreFactory {
 	return func(es.EventRegistry) (es.DataStore, error) {
-		return basic.NewMemoryStore(), nil
+		return basic.NewMemoryStore(opts...), nil
 	}
 }
 
+// Encrypted wraps the store so event payloads and snapshots are encrypted
+// with the keyring
+func Encrypted(keyring *es.Keyring, factory DataStoreFactory) DataStoreFactory {
+	return func(r es.EventRegistry) (es.DataStore, error) {
+		store, err := factory(encryptedRegistry{r})
+		if err != nil {
+			return nil, err
+		}
+		return es.NewEncryptedStore(store, keyring, r.Get), nil
+	}
+}
+
+// encryptedRegistry makes the wrapped store decode every payload as
+// es.EncryptedData
+type encryptedRegistry struct {
+	es.EventRegistry
+}
+
+func (encryptedRegistry) Get(name string) (interface{}, error) {
+	return es.EncryptedEventData(name)
+}
+
 // Mongo generates a MongoDB implementation of EventStore
-func Mongo(uri, db, username, password string, createIndexes bool) DataStoreFactory {
+func Mongo(uri, db, username, password string, createIndexes bool, opts ...mongo.Option) DataStoreFactory {
 	return func(r es.EventRegistry) (es.DataStore, error) {
 		data, err := mongo.Create(uri, db, username, password, createIndexes)
 		if err != nil {
 			return nil, err
 		}
 
-		return mongo.NewStore(data, r.Get)
+		return mongo.NewStore(data, r.Get, opts...)
 	}
 }
 
 // Nats generates a Nats implementation of EventBus
-func Nats(uri string, namespace string) EventPublisherFactory {
+func Nats(uri string, namespace string, opts ...nats.Option) EventPublisherFactory {
 	return func() (es.EventPublisher, error) {
-		return nats.NewClient(uri, namespace)
+		return nats.NewClient(uri, namespace, opts...)
 	}
 }
 
 // GCPPubSub generates a pubsub implementation of EventBus
-func GCPPubSub(projectID string, topicName string) EventPublisherFactory {
+func GCPPubSub(projectID string, topicName string, opts ...gcp.Option) EventPublisherFactory {
 	return func() (es.EventPublisher, error) {
-		return gcp.NewClient(projectID, topicName)
+		return gcp.NewClient(projectID, topicName, opts...)
 	}
 }
 
@@ -92,9 +118,27 @@ type ClientBuilder interface {
 
 	RegisterEvents(events ...*EventConfig)
 	AddPublisher(publisher EventPublisherFactory)
+	// Deprecated: SetDefaultSnapshotMin snapshots every min+1 versions, a
+	// negative min disables snapshots. Use SetDefaultSnapshotStrategy.
 	SetDefaultSnapshotMin(min int)
+	SetDefaultSnapshotStrategy(strategy es.SnapshotStrategy)
 	SetDefaultRevision(rev string)
 	SetDefaultProject(project bool)
+	// SetAsyncSnapshots saves snapshots in the background after the command returns
+	SetAsyncSnapshots()
+	// SetPurgeSnapshots deletes snapshots of other revisions on Build, for
+	// the data without a tenant and for each of the tenants
+	SetPurgeSnapshots(tenants ...string)
+	// SetClock sets the clock used to timestamp events, defaults to the system clock
+	SetClock(clock es.Clock)
+	// SetTracerProvider enables tracing of commands and events
+	SetTracerProvider(tp trace.TracerProvider)
+	// SetMetrics registers the es collectors with reg and records metrics
+	SetMetrics(reg prometheus.Registerer)
+	// SetLogger sets the logger passed to command handlers and stores, it
+	// defaults to the global zerolog logger at info level
+	SetLogger(logger es.Logger)
+	// SetDebug lowers the level of the default logger to debug
 	SetDebug()
 
 	WireSaga(saga es.Saga, events ...interface{})
@@ -103,14 +147,20 @@ type ClientBuilder interface {
 
 	MakeAggregateStore(aggregate es.Aggregate) *es.AggregateStore
 
+	// SetStrictValidation makes Build fail when Validate finds problems,
+	// otherwise they are logged. Aggregates must also declare their
+	// commands and events.
+	SetStrictValidation()
+	Validate() error
+
 	Build() (*Client, error)
 }
 
 // NewClientBuilder create a new client builder
 func NewClientBuilder(storeFactory DataStoreFactory) (ClientBuilder, error) {
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-
 	registry := es.NewEventRegistry()
+	registry.Set(&es.Tombstone{}, false)
+
 	store, err := storeFactory(registry)
 	if err != nil {
 		return nil, err
@@ -121,11 +171,14 @@ func NewClientBuilder(storeFactory DataStoreFactory) (ClientBuilder, error) {
 	return &builder{
 		eventRegistry: registry,
 		dataStore:     store,
-		snapshotMin:   -1,
+		snapshot:      es.SnapshotNever(),
+		clock:         es.SystemClock(),
 		revision:      "",
 		project:       false,
 		eventHandler:  local,
 		eventBus:      es.NewEventBus(registry, local),
+
+		aggregateFactories: make(map[string]es.AggregateSourcedFactory),
 	}, nil
 }
 
@@ -134,10 +187,26 @@ type builder struct {
 	dataStore     es.DataStore
 	eventBus      es.EventBus
 	eventHandler  *es.LocalEventHandler
-	snapshotMin   int
+	snapshot      es.SnapshotStrategy
 	revision      string
 	project       bool
-
+	asyncSnapshot bool
+	purgeSnapshot bool
+	purgeTenants  []string
+	clock         es.Clock
+
+	tracerProvider trace.TracerProvider
+	registerer     prometheus.Registerer
+	metrics        *es.Metrics
+	logger         es.Logger
+	debug          bool
+
+	strictValidation bool
+	wiredAggregates  []*wiredAggregate
+	wiredSagas       []*wiredSaga
+	wiredCommands    [][]*CommandConfig
+
+	aggregateFactories      map[string]es.AggregateSourcedFactory
 	eventPublisherFactories []EventPublisherFactory
 	eventHandlerFactories   []EventHandlerFactory
 	commandHandlerSetters   []CommandHandlerSetter
@@ -158,7 +227,14 @@ func (b *builder) AddPublisher(factory EventPublisherFactory) {
 }
 
 func (b *builder) SetDefaultSnapshotMin(min int) {
-	b.snapshotMin = min
+	if min < 0 {
+		b.snapshot = es.SnapshotNever()
+		return
+	}
+	b.snapshot = es.SnapshotEvery(min + 1)
+}
+func (b *builder) SetDefaultSnapshotStrategy(strategy es.SnapshotStrategy) {
+	b.snapshot = strategy
 }
 func (b *builder) SetDefaultRevision(rev string) {
 	b.revision = rev
@@ -167,11 +243,54 @@ func (b *builder) SetDefaultProject(project bool) {
 	b.project = project
 }
 
+func (b *builder) SetAsyncSnapshots() {
+	b.asyncSnapshot = true
+}
+func (b *builder) SetPurgeSnapshots(tenants ...string) {
+	b.purgeSnapshot = true
+	b.purgeTenants = tenants
+}
+
+func (b *builder) SetClock(clock es.Clock) {
+	b.clock = clock
+}
+
+func (b *builder) SetTracerProvider(tp trace.TracerProvider) {
+	b.tracerProvider = tp
+}
+
+func (b *builder) SetMetrics(reg prometheus.Registerer) {
+	b.registerer = reg
+}
+
+func (b *builder) SetLogger(logger es.Logger) {
+	b.logger = logger
+}
+
 func (b *builder) SetDebug() {
-	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	b.debug = true
+}
+
+// getLogger returns the logger set or the default one
+func (b *builder) getLogger() es.Logger {
+	if b.logger != nil {
+		return b.logger
+	}
+
+	level := zerolog.InfoLevel
+	if b.debug {
+		level = zerolog.DebugLevel
+	}
+	return es.ZerologLogger(log.Logger.Level(level))
+}
+
+func (b *builder) SetStrictValidation() {
+	b.strictValidation = true
 }
 
 func (b *builder) WireSaga(saga es.Saga, events ...interface{}) {
+	b.wiredSagas = append(b.wiredSagas, &wiredSaga{saga, events})
+
 	var creater = func(b es.CommandBus) es.EventHandler {
 		return es.NewSagaHandler(b, saga, es.MatchAnyEventOf(events...))
 	}
@@ -183,18 +302,27 @@ func (b *builder) WireSaga(saga es.Saga, events ...interface{}) {
 func (b *builder) WireAggregate(aggregate *AggregateConfig, commands ...*CommandConfig) {
 	factory := es.NewAggregateSourcedFactory(aggregate.AggregateFunc)
 
+	_, name := es.GetTypeName(aggregate.AggregateFunc())
+	b.aggregateFactories[name] = factory
+	b.wiredAggregates = append(b.wiredAggregates, &wiredAggregate{aggregate, commands})
+
 	var fn = func(commandBus es.CommandBus, store es.DataStore, eventBus es.EventBus) error {
-		handler := es.NewAggregateHandler(factory, store, eventBus, b.revision, b.snapshotMin, b.project)
+		snapshot := aggregate.SnapshotStrategy
+		if snapshot == nil {
+			snapshot = b.snapshot
+		}
+
+		handler := es.NewAggregateHandler(factory, store, eventBus, b.revision, snapshot, b.project)
 		handlerMiddleware := es.UseCommandHandlerMiddleware(handler, aggregate.Middleware...)
 
 		for _, cmd := range commands {
 			h := es.UseCommandHandlerMiddleware(handlerMiddleware, cmd.Middleware...)
 
-			if err := commandBus.SetHandler(h, cmd.Command); err != nil {
+			if err := commandBus.SetHandler(b.wrapCommandHandler(h), cmd.Command); err != nil {
 				return err
 			}
 		}
-		if err := commandBus.SetHandler(handler, &es.ReplayCommand{}); err != nil {
+		if err := commandBus.SetHandler(b.wrapCommandHandler(handler), &es.ReplayCommand{}); err != nil {
 			return err
 		}
 		return nil
@@ -204,11 +332,13 @@ func (b *builder) WireAggregate(aggregate *AggregateConfig, commands ...*Command
 }
 
 func (b *builder) WireCommandHandler(handler es.CommandHandler, commands ...*CommandConfig) {
+	b.wiredCommands = append(b.wiredCommands, commands)
+
 	var fn = func(commandBus es.CommandBus, store es.DataStore, eventBus es.EventBus) error {
 		for _, cmd := range commands {
 			h := es.UseCommandHandlerMiddleware(handler, cmd.Middleware...)
 
-			if err := commandBus.SetHandler(h, cmd.Command); err != nil {
+			if err := commandBus.SetHandler(b.wrapCommandHandler(h), cmd.Command); err != nil {
 				return err
 			}
 		}
@@ -218,22 +348,81 @@ func (b *builder) WireCommandHandler(handler es.CommandHandler, commands ...*Com
 	b.commandHandlerSetters = append(b.commandHandlerSetters, fn)
 }
 
+// wrapCommandHandler adds the middleware every command handler gets
+func (b *builder) wrapCommandHandler(h es.CommandHandler) es.CommandHandler {
+	middleware := []es.CommandHandlerMiddleware{
+		es.ClockMiddleware(b.clock),
+		es.LoggerMiddleware(b.getLogger()),
+	}
+	if b.tracerProvider != nil {
+		middleware = append(middleware, es.CommandTracingMiddleware(b.tracerProvider))
+	}
+	if b.metrics != nil {
+		middleware = append(middleware, es.CommandMetricsMiddleware(b.metrics))
+	}
+	return es.UseCommandHandlerMiddleware(h, middleware...)
+}
+
+// wrapEventHandler adds the middleware every event handler gets
+func (b *builder) wrapEventHandler(h es.EventHandler) es.EventHandler {
+	if b.tracerProvider != nil {
+		return es.UseEventHandlerMiddleware(h, es.EventTracingMiddleware(b.tracerProvider))
+	}
+	return h
+}
+
 func (b *builder) MakeAggregateStore(aggregate es.Aggregate) *es.AggregateStore {
 	factory := es.NewAggregateFactory(aggregate)
-	return es.NewAggregateStore(factory, b.dataStore, b.eventBus)
+	return es.NewAggregateStore(factory, b.dataStore, b.eventBus, es.AggregateStoreLogger(b.getLogger()))
 }
 
 func (b *builder) Build() (*Client, error) {
-	log.Debug().Msg("Starting to build the go-es Client")
+	logger := b.getLogger()
+	logger.Debug("Starting to build the go-es Client")
+
+	if err := b.Validate(); err != nil {
+		if b.strictValidation {
+			return nil, err
+		}
+		for _, problem := range err.(*ValidationError).Problems {
+			logger.Error("Wiring problem", "problem", problem)
+		}
+	}
+
+	if b.purgeSnapshot {
+		// the stores only see the snapshots of the tenant of ctx
+		ctx := es.WithLogger(context.Background(), logger)
+		for _, tenant := range append([]string{""}, b.purgeTenants...) {
+			if err := es.PurgeStaleSnapshots(es.WithTenant(ctx, tenant), b.dataStore, b.revision); err != nil {
+				return nil, err
+			}
+		}
+
+		logger.Debug("Stale snapshots purged")
+	}
+
+	if b.registerer != nil {
+		b.metrics = es.NewMetrics("es")
+		if err := b.metrics.Register(b.registerer); err != nil {
+			return nil, err
+		}
+
+		logger.Debug("Metrics registered")
+	}
+
+	dataStore := b.dataStore
+	if b.asyncSnapshot {
+		dataStore = es.NewAsyncSnapshotStore(dataStore)
+	}
 
 	commandBus := es.NewCommandBus()
 
 	// create the event handlers
 	for _, fn := range b.eventHandlerFactories {
 		eh := fn(commandBus)
-		b.eventHandler.AddHandler(eh)
+		b.eventHandler.AddHandler(b.wrapEventHandler(eh))
 
-		log.Debug().Msg("Event Handler added")
+		logger.Debug("Event Handler added")
 	}
 
 	for _, fn := range b.eventPublisherFactories {
@@ -243,16 +432,23 @@ func (b *builder) Build() (*Client, error) {
 		}
 		b.eventBus.AddPublisher(p)
 
-		log.Debug().Msg("Event Publisher added")
+		logger.Debug("Event Publisher added")
 	}
 
 	for _, fn := range b.commandHandlerSetters {
-		if err := fn(commandBus, b.dataStore, b.eventBus); err != nil {
+		if err := fn(commandBus, dataStore, b.eventBus); err != nil {
 			return nil, err
 		}
 
-		log.Debug().Msg("Command Handler configured")
+		logger.Debug("Command Handler configured")
 	}
 
-	return NewClient(b.dataStore, b.eventRegistry, b.eventHandler, b.eventBus, commandBus), nil
+	cli := NewClient(dataStore, b.eventRegistry, b.eventHandler, b.eventBus, commandBus)
+	cli.Clock = b.clock
+	cli.Metrics = b.metrics
+	cli.Logger = logger
+	for name, factory := range b.aggregateFactories {
+		cli.Aggregates[name] = factory
+	}
+	return cli, nil
 }
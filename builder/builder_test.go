@@ -0,0 +1,47 @@
+package builder
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextgg/go-es/es"
+)
+
+func TestPurgeSnapshotsOfTenants(t *testing.T) {
+	ctx := context.Background()
+
+	b := newBuilder(t)
+	b.WireAggregate(Aggregate(&Auth{}), Command(&Login{}), Command(&Logout{}))
+	b.SetDefaultRevision("v2")
+	b.SetPurgeSnapshots("acme")
+
+	store, ok := es.AsStore[es.SnapshotStore](b.GetDataStore())
+	if !ok {
+		t.Fatal("expected a snapshot store")
+	}
+
+	contexts := []context.Context{ctx, es.WithTenant(ctx, "acme")}
+	for _, ctx := range contexts {
+		aggregate := &Auth{}
+		aggregate.Initialize("1", "Auth")
+		if err := b.GetDataStore().SaveSnapshot(ctx, "v1", aggregate); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for _, ctx := range contexts {
+		records, err := store.ListSnapshots(ctx, "v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 0 {
+			t.Errorf("expected the snapshots of tenant %q to be purged, got %d", es.TenantFromContext(ctx), len(records))
+		}
+	}
+}
@@ -18,6 +18,9 @@ func NewClient(
 		EventHandler:  eventHandler,
 		EventBus:      eventBus,
 		CommandBus:    commandBus,
+		Clock:         es.SystemClock(),
+		Logger:        es.DefaultLogger(),
+		Aggregates:    make(map[string]es.AggregateSourcedFactory),
 	}
 }
 
@@ -28,6 +31,18 @@ type Client struct {
 	EventHandler  es.EventHandler
 	EventBus      es.EventBus
 	CommandBus    es.CommandBus
+
+	// Clock used to timestamp events
+	Clock es.Clock
+
+	// Metrics recorded by the client, nil unless SetMetrics was used
+	Metrics *es.Metrics
+
+	// Logger used by the client
+	Logger es.Logger
+
+	// Aggregates holds the factory of every wired aggregate by type name
+	Aggregates map[string]es.AggregateSourcedFactory
 }
 
 // Close all the underlying services
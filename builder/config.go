@@ -4,8 +4,20 @@ import "github.com/contextgg/go-es/es"
 
 // AggregateConfig hold information regarding aggregate
 type AggregateConfig struct {
-	AggregateFunc es.AggregateSourcedFunc
-	Middleware    []es.CommandHandlerMiddleware
+	AggregateFunc    es.AggregateSourcedFunc
+	Middleware       []es.CommandHandlerMiddleware
+	SnapshotStrategy es.SnapshotStrategy
+
+	// Commands and Events declared by the aggregate for Build validation,
+	// when nil they come from es.DeclaredCommands and es.DeclaredEvents
+	Commands []es.Command
+	Events   []interface{}
+}
+
+// Snapshot overrides the default snapshot strategy for the aggregate
+func (c *AggregateConfig) Snapshot(strategy es.SnapshotStrategy) *AggregateConfig {
+	c.SnapshotStrategy = strategy
+	return c
 }
 
 // CommandConfig hold information regarding command
@@ -0,0 +1,33 @@
+package builder
+
+import "github.com/contextgg/go-es/es"
+
+// TypedAggregate creates a new AggregateConfig from the constructor of A
+func TypedAggregate[A es.AggregateSourced](fn func() A, middleware ...es.CommandHandlerMiddleware) *AggregateConfig {
+	return AggregateFunc(func() es.AggregateSourced {
+		return fn()
+	}, middleware...)
+}
+
+// WireTypedAggregate wires aggregate A to every command registered on its
+// handlers. The returned config can still be changed until Build.
+func WireTypedAggregate[A es.AggregateSourced](b ClientBuilder, handlers *es.Handlers[A], middleware ...es.CommandHandlerMiddleware) *AggregateConfig {
+	var aggregate A
+	config := Aggregate(aggregate, middleware...)
+	config.Commands = handlers.Commands()
+	config.Events = handlers.Events()
+
+	var commands []*CommandConfig
+	for _, cmd := range handlers.Commands() {
+		commands = append(commands, Command(cmd))
+	}
+
+	b.WireAggregate(config, commands...)
+	return config
+}
+
+// MakeTypedAggregateStore creates a store for loading and saving A
+func MakeTypedAggregateStore[A es.Aggregate](b ClientBuilder) *es.TypedAggregateStore[A] {
+	var aggregate A
+	return es.AsTypedAggregateStore[A](b.MakeAggregateStore(aggregate))
+}
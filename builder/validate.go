@@ -0,0 +1,119 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/contextgg/go-es/es"
+)
+
+// ValidationError lists every wiring problem found by Validate
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%d wiring problem(s):\n\t%s", len(e.Problems), strings.Join(e.Problems, "\n\t"))
+}
+
+type wiredAggregate struct {
+	config   *AggregateConfig
+	commands []*CommandConfig
+}
+
+type wiredSaga struct {
+	saga   es.Saga
+	events []interface{}
+}
+
+func typeName(source interface{}) string {
+	_, name := es.GetTypeName(source)
+	return name
+}
+
+// Validate checks the commands and events declared by the aggregates
+// against what was wired and registered
+func (b *builder) Validate() error {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	wired := map[string]string{}
+	wire := func(cmd es.Command, owner string) {
+		name := typeName(cmd)
+		if other, ok := wired[name]; ok {
+			report("command %s is wired to both %s and %s", name, other, owner)
+			return
+		}
+		wired[name] = owner
+	}
+
+	for _, w := range b.wiredAggregates {
+		aggregate := w.config.AggregateFunc()
+		name := typeName(aggregate)
+
+		for _, cmd := range w.commands {
+			wire(cmd.Command, name)
+		}
+
+		commands := w.config.Commands
+		declared := commands != nil
+		if !declared {
+			commands, declared = es.DeclaredCommands(aggregate)
+		}
+		if declared {
+			handled := map[string]bool{}
+			for _, cmd := range commands {
+				handled[typeName(cmd)] = true
+			}
+			for _, cmd := range w.commands {
+				if !handled[typeName(cmd.Command)] {
+					report("command %s is wired to %s which does not handle it", typeName(cmd.Command), name)
+				}
+				delete(handled, typeName(cmd.Command))
+			}
+			for _, cmd := range commands {
+				if handled[typeName(cmd)] {
+					report("command %s is handled by %s but not wired", typeName(cmd), name)
+				}
+			}
+		} else if b.strictValidation {
+			report("aggregate %s does not declare the commands it handles", name)
+		}
+
+		events := w.config.Events
+		declared = events != nil
+		if !declared {
+			events, declared = es.DeclaredEvents(aggregate)
+		}
+		if declared {
+			for _, evt := range events {
+				if !b.eventRegistry.Has(typeName(evt)) {
+					report("event %s of %s is not registered", typeName(evt), name)
+				}
+			}
+		} else if b.strictValidation {
+			report("aggregate %s does not declare the events it applies", name)
+		}
+	}
+
+	for _, cmds := range b.wiredCommands {
+		for _, cmd := range cmds {
+			wire(cmd.Command, "a command handler")
+		}
+	}
+
+	for _, w := range b.wiredSagas {
+		for _, evt := range w.events {
+			if !b.eventRegistry.Has(typeName(evt)) {
+				report("event %s of saga %s is not registered", typeName(evt), typeName(w.saga))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{problems}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/contextgg/go-es/es"
+)
+
+type Login struct {
+	es.BaseCommand
+}
+type Logout struct {
+	es.BaseCommand
+}
+type Delete struct {
+	es.BaseCommand
+}
+
+type LoggedIn struct{}
+type LoggedOut struct{}
+
+// Auth is a routed aggregate so it declares its commands and events
+type Auth struct {
+	es.BaseAggregateRouted
+}
+
+func (a *Auth) HandleLogin(ctx context.Context, cmd *Login) error {
+	a.StoreEvent(&LoggedIn{})
+	return nil
+}
+func (a *Auth) HandleLogout(ctx context.Context, cmd *Logout) error {
+	a.StoreEvent(&LoggedOut{})
+	return nil
+}
+func (a *Auth) ApplyLoggedIn(*LoggedIn)   {}
+func (a *Auth) ApplyLoggedOut(*LoggedOut) {}
+
+// Legacy uses a type switch and declares nothing
+type Legacy struct {
+	es.BaseAggregateSourced
+}
+
+func (a *Legacy) HandleCommand(context.Context, es.Command) error { return nil }
+func (a *Legacy) ApplyEvent(context.Context, interface{}) error   { return nil }
+
+type AuthSaga struct{}
+
+func (s *AuthSaga) Run(context.Context, *es.Event) ([]es.Command, error) {
+	return nil, nil
+}
+
+func newBuilder(t *testing.T) ClientBuilder {
+	b, err := NewClientBuilder(LocalStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetLogger(es.NopLogger())
+	return b
+}
+
+func TestValidateCompleteWiring(t *testing.T) {
+	b := newBuilder(t)
+	b.SetStrictValidation()
+	b.RegisterEvents(
+		Event(&LoggedIn{}, false),
+		Event(&LoggedOut{}, false),
+	)
+	b.WireAggregate(Aggregate(&Auth{}), Command(&Login{}), Command(&Logout{}))
+	b.WireSaga(&AuthSaga{}, &LoggedIn{})
+
+	if _, err := b.Build(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateReportsProblems(t *testing.T) {
+	b := newBuilder(t)
+	b.RegisterEvents(Event(&LoggedIn{}, false))
+	b.WireAggregate(Aggregate(&Auth{}), Command(&Login{}), Command(&Delete{}))
+	b.WireAggregate(Aggregate(&Legacy{}), Command(&Login{}))
+	b.WireSaga(&AuthSaga{}, &LoggedOut{})
+
+	err := b.Validate()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("got %v, want a ValidationError", err)
+	}
+
+	want := []string{
+		"command Delete is wired to Auth which does not handle it",
+		"command Logout is handled by Auth but not wired",
+		"event LoggedOut of Auth is not registered",
+		"command Login is wired to both Auth and Legacy",
+		"event LoggedOut of saga AuthSaga is not registered",
+	}
+	if got := strings.Join(verr.Problems, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("got problems:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+func TestStrictValidation(t *testing.T) {
+	b := newBuilder(t)
+	b.WireAggregate(Aggregate(&Legacy{}), Command(&Login{}))
+
+	// undeclared aggregates are only a problem in strict mode
+	if err := b.Validate(); err != nil {
+		t.Fatalf("got %v, want no problems", err)
+	}
+
+	b.SetStrictValidation()
+	if _, err := b.Build(); err == nil {
+		t.Fatal("expected Build to fail")
+	} else if !strings.Contains(err.Error(), "Legacy does not declare the commands") {
+		t.Errorf("got %v", err)
+	}
+}
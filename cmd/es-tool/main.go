@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/contextgg/go-es/builder"
+	"github.com/contextgg/go-es/es"
+	"github.com/contextgg/go-es/es/mongo"
+	"github.com/contextgg/go-es/tool"
+)
+
+// This binary has no aggregates wired so it works on raw streams, replay
+// checks every stream loads and applies without writing anything. Services
+// rebuild their aggregates by calling tool.Main from their own main.
+func main() {
+	uri := flag.String("mongo-uri", "mongodb://localhost:27017", "MongoDB connection string")
+	db := flag.String("db", "", "MongoDB database")
+	username := flag.String("username", "", "MongoDB username")
+	password := flag.String("password", "", "MongoDB password")
+	flag.Parse()
+
+	b, err := builder.NewClientBuilder(func(es.EventRegistry) (es.DataStore, error) {
+		data, err := mongo.Create(*uri, *db, *username, *password, false)
+		if err != nil {
+			return nil, err
+		}
+		return mongo.NewStore(data, mongo.RawEventData)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	cli, err := b.Build()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	err = tool.Run(context.Background(), cli, flag.Args(), os.Stdout, os.Stderr)
+	cli.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -42,13 +42,23 @@ func NewAggregateFactory(aggregate Aggregate) AggregateFactory {
 	}
 }
 
-// NewAggregateSourcedFactory builds an aggregate
+// NewAggregateSourcedFactory builds an aggregate, aggregates embedding
+// BaseAggregateRouted are bound to a dispatch table built once per type
 func NewAggregateSourcedFactory(fn AggregateSourcedFunc) AggregateSourcedFactory {
-	_, aggregateName := GetTypeName(fn())
+	sample := fn()
+	_, aggregateName := GetTypeName(sample)
+
+	var r *routes
+	if _, ok := sample.(routedAggregate); ok {
+		r = routesFor(reflect.TypeOf(sample))
+	}
 
 	return func(id string) (AggregateSourced, error) {
 		aggregate := fn()
 		aggregate.Initialize(id, aggregateName)
+		if r != nil {
+			aggregate.(routedAggregate).bindRoutes(aggregate, r)
+		}
 		return aggregate, nil
 	}
 }
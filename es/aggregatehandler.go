@@ -3,6 +3,9 @@ package es
 import (
 	"context"
 	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ApplyEventError is when an event could not be applied. It contains the error
@@ -36,50 +39,83 @@ func NewAggregateHandler(
 	dataStore DataStore,
 	eventBus EventBus,
 	revision string,
-	minVersionDiff int,
+	snapshot SnapshotStrategy,
 	project bool,
 ) CommandHandler {
+	if snapshot == nil {
+		snapshot = SnapshotNever()
+	}
+
 	return &aggregateHandler{
-		factory:        factory,
-		dataStore:      dataStore,
-		eventBus:       eventBus,
-		revision:       revision,
-		minVersionDiff: minVersionDiff,
-		project:        project,
+		factory:   factory,
+		dataStore: dataStore,
+		eventBus:  eventBus,
+		revision:  revision,
+		snapshot:  snapshot,
+		project:   project,
 	}
 }
 
 type aggregateHandler struct {
-	factory        AggregateSourcedFactory
-	dataStore      DataStore
-	eventBus       EventBus
-	revision       string
-	project        bool
-	minVersionDiff int
+	factory   AggregateSourcedFactory
+	dataStore DataStore
+	eventBus  EventBus
+	revision  string
+	project   bool
+	snapshot  SnapshotStrategy
 }
 
 func (h *aggregateHandler) applyEvents(ctx context.Context, aggregate AggregateSourced, originalEvents []*Event) error {
-	aggregateType := aggregate.GetTypeName()
-
 	for _, event := range originalEvents {
-		if event.AggregateType != aggregateType {
-			return ErrMismatchedEventType
+		if err := h.applyEvent(ctx, aggregate, event); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		// lets build the event!
-		if err := aggregate.ApplyEvent(ctx, event.Data); err != nil {
-			return ApplyEventError{
-				Event: event,
-				Err:   err,
-			}
+func (h *aggregateHandler) applyEvent(ctx context.Context, aggregate AggregateSourced, event *Event) error {
+	if event.AggregateType != aggregate.GetTypeName() {
+		return ErrMismatchedEventType
+	}
+
+	// lets build the event!
+	if err := ApplyEvent(ctx, aggregate, event.Data); err != nil {
+		return ApplyEventError{
+			Event: event,
+			Err:   err,
 		}
-		aggregate.IncrementVersion()
 	}
 	return nil
 }
 
+// replayEvents streams the stored events onto the aggregate, only the first
+// one is kept for the snapshot strategy
+func (h *aggregateHandler) replayEvents(ctx context.Context, aggregate AggregateSourced) (*Event, int, error) {
+	stream, err := LoadEventStream(ctx, h.dataStore, aggregate.GetID(), aggregate.GetTypeName(), aggregate.GetVersion())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer stream.Close(ctx)
+
+	var first *Event
+	count := 0
+	for stream.Next(ctx) {
+		event := stream.Event()
+		if first == nil {
+			first = event
+		}
+		if err := h.applyEvent(ctx, aggregate, event); err != nil {
+			return nil, count, err
+		}
+		count++
+	}
+	return first, count, stream.Err()
+}
+
 func (h *aggregateHandler) HandleCommand(ctx context.Context, cmd Command) error {
 	id := cmd.GetAggregateID()
+	ctx, result := claimCommandResult(ctx)
 
 	// make the aggregate
 	aggregate, err := h.factory(id)
@@ -87,39 +123,88 @@ func (h *aggregateHandler) HandleCommand(ctx context.Context, cmd Command) error
 		return err
 	}
 
+	aggregateType := aggregate.GetTypeName()
+	metrics := MetricsFromContext(ctx)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("es.aggregate_id", id),
+		attribute.String("es.aggregate_type", aggregateType),
+	)
+
 	// load up the aggregate
-	if h.minVersionDiff >= 0 {
-		if err := h.dataStore.LoadSnapshot(ctx, h.revision, aggregate); err != nil {
+	if h.snapshot.ShouldLoad() {
+		if err := traced(ctx, "es.LoadSnapshot", func(ctx context.Context) error {
+			return h.dataStore.LoadSnapshot(ctx, h.revision, aggregate)
+		}); err != nil {
 			return err
 		}
+		// a snapshot copied over the aggregate brings its routes along
+		bindRoutes(aggregate)
+		metrics.snapshotLoaded(aggregateType, aggregate.GetVersion())
 	}
 
 	originalVersion := aggregate.GetVersion()
-	aggregateType := aggregate.GetTypeName()
 
-	// load up the events from the DB.
-	originalEvents, err := h.dataStore.LoadEvents(ctx, id, aggregateType, originalVersion)
-	if err != nil {
+	// stream the events from the DB.
+	var firstReplayed *Event
+	var replayed int
+	if err := traced(ctx, "es.LoadEvents", func(ctx context.Context) error {
+		var err error
+		firstReplayed, replayed, err = h.replayEvents(ctx, aggregate)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Int("es.event_count", replayed))
+		if err != nil {
+			return err
+		}
+		metrics.eventsReplayed(aggregateType, replayed)
+		return nil
+	}); err != nil {
 		return err
 	}
-	if err := h.applyEvents(ctx, aggregate, originalEvents); err != nil {
+
+	if err := CheckLifecycle(aggregate, cmd); err != nil {
 		return err
 	}
 
+	// the client may have seen an older version
+	if ev, ok := cmd.(ExpectedVersion); ok {
+		if expected, ok := ev.GetExpectedVersion(); ok && expected != aggregate.GetVersion() {
+			metrics.versionConflict(aggregateType)
+			return &VersionConflictError{
+				AggregateID:   id,
+				AggregateType: aggregateType,
+				Expected:      expected,
+				Actual:        aggregate.GetVersion(),
+			}
+		}
+	}
+
 	// handle the command
 	switch cmd.(type) {
 	case *ReplayCommand:
 		break
 	default:
-		if err := aggregate.HandleCommand(ctx, cmd); err != nil {
+		if err := traced(ctx, "es.Aggregate.HandleCommand", func(ctx context.Context) error {
+			return aggregate.HandleCommand(ctx, cmd)
+		}); err != nil {
 			return err
 		}
 	}
 
 	// now save it!.
+	now := Now(ctx)
 	events := aggregate.Events()
+	tenant := TenantFromContext(ctx)
+	for _, e := range events {
+		e.Timestamp = now
+		e.Tenant = tenant
+		InjectTrace(ctx, MetadataCarrier(e))
+	}
 	if len(events) > 0 {
-		if err := h.dataStore.SaveEvents(ctx, events, aggregate.GetVersion()); err != nil {
+		if err := traced(ctx, "es.SaveEvents", func(ctx context.Context) error {
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Int("es.event_count", len(events)))
+			err := h.dataStore.SaveEvents(ctx, events, aggregate.GetVersion())
+			metrics.eventsSaved(aggregateType, events, err)
+			return err
+		}); err != nil {
 			return err
 		}
 		aggregate.ClearEvents()
@@ -130,28 +215,65 @@ func (h *aggregateHandler) HandleCommand(ctx context.Context, cmd Command) error
 		}
 	}
 
+	if result != nil {
+		result.AggregateID = id
+		result.Version = aggregate.GetVersion()
+		result.Events = events
+	}
+
 	// save the snapshot!
 	diff := aggregate.GetVersion() - originalVersion
 	if diff < 0 {
 		return ErrWrongVersion
 	}
-	if diff > h.minVersionDiff {
-		if err := h.dataStore.SaveSnapshot(ctx, h.revision, aggregate); err != nil {
+	info := SnapshotInfo{
+		Aggregate:       aggregate,
+		SnapshotVersion: originalVersion,
+		FirstReplayed:   firstReplayed,
+		ReplayedCount:   replayed,
+		Committed:       events,
+		Now:             now,
+	}
+	if h.snapshot.ShouldSave(info) {
+		if err := traced(ctx, "es.SaveSnapshot", func(ctx context.Context) error {
+			return h.dataStore.SaveSnapshot(ctx, h.revision, aggregate)
+		}); err != nil {
 			return err
 		}
 	}
 
-	if h.project {
-		if err := h.dataStore.SaveAggregate(ctx, aggregate); err != nil {
+	if h.project && isDeleted(aggregate) {
+		deleter, ok := AsStore[AggregateDeleter](h.dataStore)
+		if !ok {
+			// the tombstone is stored already, never project the deleted
+			// aggregate but leave its old projection alone
+			LoggerFromContext(ctx, nil).Error("Could not delete the projection",
+				"error", ErrAggregateDeleterNotSupported,
+				"id", aggregate.GetID(),
+				"type_name", aggregate.GetTypeName(),
+			)
+		} else if err := traced(ctx, "es.DeleteAggregate", func(ctx context.Context) error {
+			return deleter.DeleteAggregate(ctx, aggregate)
+		}); err != nil {
 			return err
 		}
-	}
-
-	for _, e := range events {
-		if err := h.eventBus.HandleEvent(ctx, e); err != nil {
+	} else if h.project {
+		if err := traced(ctx, "es.SaveAggregate", func(ctx context.Context) error {
+			return h.dataStore.SaveAggregate(ctx, aggregate)
+		}); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	if len(events) == 0 {
+		return nil
+	}
+	return traced(ctx, "es.PublishEvents", func(ctx context.Context) error {
+		for _, e := range events {
+			if err := h.eventBus.HandleEvent(ctx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
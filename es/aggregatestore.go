@@ -2,17 +2,29 @@ package es
 
 import (
 	"context"
-
-	"github.com/rs/zerolog/log"
 )
 
+// AggregateStoreOption configures an AggregateStore
+type AggregateStoreOption = func(*AggregateStore)
+
+// AggregateStoreLogger sets the logger used when the context has none
+func AggregateStoreLogger(logger Logger) AggregateStoreOption {
+	return func(a *AggregateStore) {
+		a.logger = logger
+	}
+}
+
 // NewAggregateStore creates a new store for a specific aggregate
-func NewAggregateStore(factory AggregateFactory, dataStore DataStore, bus EventBus) *AggregateStore {
-	return &AggregateStore{
+func NewAggregateStore(factory AggregateFactory, dataStore DataStore, bus EventBus, opts ...AggregateStoreOption) *AggregateStore {
+	a := &AggregateStore{
 		factory:   factory,
 		dataStore: dataStore,
 		bus:       bus,
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 // AggregateStore for loading and saving to the datastore
@@ -20,84 +32,77 @@ type AggregateStore struct {
 	factory   AggregateFactory
 	dataStore DataStore
 	bus       EventBus
+	logger    Logger
 }
 
 // LoadAggregate from the datastore
 func (a *AggregateStore) LoadAggregate(ctx context.Context, id string) (Aggregate, error) {
+	logger := LoggerFromContext(ctx, a.logger)
+
 	aggregate, err := a.factory(id)
 	if err != nil {
-		log.
-			Error().
-			Err(err).
-			Str("id", id).
-			Msg("Could not create Aggregate with factory")
+		logger.Error("Could not create Aggregate with factory",
+			"error", err,
+			"id", id,
+		)
 		return nil, err
 	}
 	if err := a.dataStore.LoadAggregate(ctx, aggregate); err != nil {
-		log.
-			Error().
-			Err(err).
-			Str("id", aggregate.GetID()).
-			Str("type_name", aggregate.GetTypeName()).
-			Msg("Could not load aggregate")
+		logger.Error("Could not load aggregate",
+			"error", err,
+			"id", aggregate.GetID(),
+			"type_name", aggregate.GetTypeName(),
+		)
 		return nil, err
 	}
 
-	log.
-		Debug().
-		Str("id", aggregate.GetID()).
-		Str("type_name", aggregate.GetTypeName()).
-		Msg("LoadAggregate successful")
+	logger.Debug("LoadAggregate successful",
+		"id", aggregate.GetID(),
+		"type_name", aggregate.GetTypeName(),
+	)
 	return aggregate, nil
 }
 
 // SaveAggregate and handle events if needed
 func (a *AggregateStore) SaveAggregate(ctx context.Context, aggregate Aggregate) error {
-	sublogger := log.With().
-		Str("id", aggregate.GetID()).
-		Str("type_name", aggregate.GetTypeName()).
-		Logger()
+	sublogger := LoggerFromContext(ctx, a.logger).With(
+		"id", aggregate.GetID(),
+		"type_name", aggregate.GetTypeName(),
+	)
+
+	// events are stamped with the clock of ctx like the ones of the handler
+	holder, isHolder := aggregate.(EventHolder)
+	if isHolder {
+		now := Now(ctx)
+		for _, e := range holder.EventsToPublish() {
+			e.Timestamp = now
+		}
+	}
 
 	if err := a.dataStore.SaveAggregate(ctx, aggregate); err != nil {
-		sublogger.
-			Error().
-			Err(err).
-			Msg("Could not save aggregate")
+		sublogger.Error("Could not save aggregate", "error", err)
 		return err
 	}
 
 	// Publish events if supported by the aggregate.
-	if holder, ok := aggregate.(EventHolder); ok && a.bus != nil {
+	if isHolder && a.bus != nil {
 		events := holder.EventsToPublish()
 		holder.ClearEvents()
 
-		sublogger.
-			Debug().
-			Int("event_count", len(events)).
-			Msg("Aggregate is an EventHolder")
+		sublogger.Debug("Aggregate is an EventHolder", "event_count", len(events))
 
 		for _, e := range events {
-			subsublogger := sublogger.
-				With().
-				Str("event_type", e.Type).
-				Logger()
+			subsublogger := sublogger.With("event_type", e.Type)
 
 			if err := a.bus.HandleEvent(ctx, e); err != nil {
-				subsublogger.
-					Error().
-					Err(err).
-					Msg("Error handling event with EventBus")
+				subsublogger.Error("Error handling event with EventBus", "error", err)
 				return err
 			}
 
-			subsublogger.
-				Debug().
-				Msg("Event handled by EventBus")
+			subsublogger.Debug("Event handled by EventBus")
 		}
 	}
 
-	sublogger.
-		Debug().
-		Msg("SaveAggregate successful")
+	sublogger.Debug("SaveAggregate successful")
 	return nil
 }
@@ -2,6 +2,7 @@ package es
 
 import (
 	"context"
+	"os"
 	"testing"
 
 	"github.com/rs/zerolog"
@@ -63,11 +64,11 @@ func isAggregate(aggregate interface{}) (Aggregate, bool) {
 }
 
 func TestSavingAggregate(t *testing.T) {
-	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	logger := ZerologLogger(zerolog.New(os.Stdout).Level(zerolog.DebugLevel))
 
 	dataStore := &TestDataStore{}
 	bus := &TestBus{}
-	store := NewAggregateStore(nil, dataStore, bus)
+	store := NewAggregateStore(nil, dataStore, bus, AggregateStoreLogger(logger))
 
 	aggregate := &TestAggregate{}
 
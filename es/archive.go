@@ -0,0 +1,47 @@
+package es
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrArchiveStoreNotSupported when the datastore can't archive events
+var ErrArchiveStoreNotSupported = errors.New("DataStore does not support archiving events")
+
+// ArchiveStore is implemented by datastores that can move old events to cold
+// storage. LoadEvents still returns archived events when they are asked for,
+// so only loads from before the archived version get slower.
+type ArchiveStore interface {
+	// ArchiveEvents moves the events of a stream below a version to the
+	// archive and returns how many were moved
+	ArchiveEvents(ctx context.Context, id string, typeName string, beforeVersion int) (int, error)
+}
+
+// ArchiveSnapshotted archives the events of every aggregate of the tenant of
+// ctx with a snapshot for the revision, only the events the snapshot already
+// covers are moved and the last one is kept so the stream is never empty
+func ArchiveSnapshotted(ctx context.Context, dataStore DataStore, revision string) (int, error) {
+	snapshots, ok := AsStore[SnapshotStore](dataStore)
+	if !ok {
+		return 0, ErrSnapshotStoreNotSupported
+	}
+	archive, ok := AsStore[ArchiveStore](dataStore)
+	if !ok {
+		return 0, ErrArchiveStoreNotSupported
+	}
+
+	records, err := snapshots.ListSnapshots(ctx, revision)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, r := range records {
+		n, err := archive.ArchiveEvents(ctx, r.AggregateID, r.AggregateType, r.Version)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
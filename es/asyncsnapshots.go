@@ -0,0 +1,134 @@
+package es
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// NewAsyncSnapshotStore wraps a datastore so snapshots are saved in the
+// background instead of in the command path. Failed saves are only logged
+// since the events are already committed, the next snapshot will catch up.
+// The snapshots of an aggregate are saved one at a time, those queued behind
+// a save only keep the newest, so a slow save never overwrites a newer one.
+// Close waits for pending snapshots before closing the underlying store.
+func NewAsyncSnapshotStore(dataStore DataStore) DataStore {
+	return &asyncSnapshotStore{
+		DataStore: dataStore,
+		queued:    make(map[snapshotKey]*queuedSnapshot),
+	}
+}
+
+type snapshotKey struct {
+	tenant   string
+	typeName string
+	id       string
+	revision string
+}
+
+type queuedSnapshot struct {
+	ctx       context.Context
+	aggregate Aggregate
+}
+
+type asyncSnapshotStore struct {
+	DataStore
+
+	pending sync.WaitGroup
+
+	// a key is present while its snapshots are being saved, with the newest
+	// one waiting for its turn
+	mu     sync.Mutex
+	queued map[snapshotKey]*queuedSnapshot
+}
+
+func (s *asyncSnapshotStore) SaveSnapshot(ctx context.Context, revision string, aggregate Aggregate) error {
+	key := snapshotKey{
+		tenant:   TenantFromContext(ctx),
+		typeName: aggregate.GetTypeName(),
+		id:       aggregate.GetID(),
+		revision: revision,
+	}
+	// the command context may be cancelled once we return, its values
+	// like the tenant are still needed
+	next := &queuedSnapshot{ctx: detachedContext{ctx}, aggregate: aggregate}
+
+	s.mu.Lock()
+	if queued, ok := s.queued[key]; ok {
+		if queued == nil || versionOf(queued.aggregate) <= versionOf(aggregate) {
+			s.queued[key] = next
+		}
+		s.mu.Unlock()
+		return nil
+	}
+	s.queued[key] = nil
+	s.mu.Unlock()
+
+	s.pending.Add(1)
+	go s.save(key, next)
+	return nil
+}
+
+// save stores the snapshots of a key until none is waiting
+func (s *asyncSnapshotStore) save(key snapshotKey, next *queuedSnapshot) {
+	defer s.pending.Done()
+
+	saved := -1
+	for next != nil {
+		if version := versionOf(next.aggregate); version >= saved {
+			if err := s.DataStore.SaveSnapshot(next.ctx, key.revision, next.aggregate); err != nil {
+				LoggerFromContext(next.ctx, nil).Error("Could not save snapshot",
+					"error", err,
+					"id", key.id,
+					"type_name", key.typeName,
+					"revision", key.revision,
+				)
+			} else {
+				saved = version
+			}
+		}
+
+		s.mu.Lock()
+		next = s.queued[key]
+		if next == nil {
+			delete(s.queued, key)
+		} else {
+			s.queued[key] = nil
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Unwrap returns the store the snapshots are saved to
+func (s *asyncSnapshotStore) Unwrap() DataStore {
+	return s.DataStore
+}
+
+// Close waits for pending snapshots and closes the underlying store
+func (s *asyncSnapshotStore) Close() error {
+	s.pending.Wait()
+	return s.DataStore.Close()
+}
+
+// versionOf returns the version of sourced aggregates, 0 for the others
+func versionOf(aggregate Aggregate) int {
+	if sourced, ok := aggregate.(interface{ GetVersion() int }); ok {
+		return sourced.GetVersion()
+	}
+	return 0
+}
+
+// detachedContext keeps the values of a context but is never cancelled
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+func (detachedContext) Err() error {
+	return nil
+}
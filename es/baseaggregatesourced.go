@@ -5,6 +5,7 @@ type BaseAggregateSourced struct {
 	ID       string `bson:"id"`
 	TypeName string `bson:"type_name"`
 	Version  int    `bson:"version"`
+	Deleted  bool   `bson:"deleted,omitempty"`
 
 	events []*Event
 }
@@ -62,3 +63,13 @@ func (a *BaseAggregateSourced) Events() []*Event {
 func (a *BaseAggregateSourced) ClearEvents() {
 	a.events = nil
 }
+
+// IsDeleted returns true once a Tombstone was applied
+func (a *BaseAggregateSourced) IsDeleted() bool {
+	return a.Deleted
+}
+
+// MarkDeleted is called by the handler when it applies a Tombstone
+func (a *BaseAggregateSourced) MarkDeleted() {
+	a.Deleted = true
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/contextgg/go-es/es"
 )
@@ -18,8 +22,14 @@ type Option = func(*memoryStore)
 // AddAggregate will add aggregate to the base
 func AddAggregate(agg es.Aggregate) Option {
 	return func(ms *memoryStore) {
-		id := agg.GetID()
-		ms.allAggregates[id] = agg
+		ms.allAggregates[key(context.Background(), agg)] = agg
+	}
+}
+
+// WithPII encrypts the personal fields of the events stored
+func WithPII(pii *es.PII) Option {
+	return func(ms *memoryStore) {
+		ms.pii = pii
 	}
 }
 
@@ -27,7 +37,8 @@ func AddAggregate(agg es.Aggregate) Option {
 func NewMemoryStore(opts ...Option) es.DataStore {
 	ms := &memoryStore{
 		allEvents:     make(map[string][]*es.Event),
-		allSnapshots:  make(map[string]es.Aggregate),
+		allArchived:   make(map[string][]*es.Event),
+		allSnapshots:  make(map[string]map[string]es.Aggregate),
 		allAggregates: make(map[string]es.Aggregate),
 	}
 
@@ -39,9 +50,13 @@ func NewMemoryStore(opts ...Option) es.DataStore {
 }
 
 type memoryStore struct {
+	sync.RWMutex
+
 	allEvents     map[string][]*es.Event
-	allSnapshots  map[string]es.Aggregate
+	allArchived   map[string][]*es.Event
+	allSnapshots  map[string]map[string]es.Aggregate
 	allAggregates map[string]es.Aggregate
+	pii           *es.PII
 }
 
 func (b *memoryStore) SaveEvents(ctx context.Context, events []*es.Event, version int) error {
@@ -49,45 +64,104 @@ func (b *memoryStore) SaveEvents(ctx context.Context, events []*es.Event, versio
 		return nil
 	}
 
+	b.Lock()
+	defer b.Unlock()
+
 	id := events[0].AggregateID
 	typeName := events[0].AggregateType
 
-	index := fmt.Sprintf("%s.%s", typeName, id)
+	index := streamKey(ctx, typeName, id)
 
 	// get the existing stuff!.
 	existing := b.allEvents[index]
+	current := 0
+	if len(existing) > 0 {
+		current = existing[len(existing)-1].Version
+	}
+	if current != version {
+		return es.ErrVersionMismatch
+	}
+
+	if b.pii != nil {
+		stored := make([]*es.Event, len(events))
+		for i, e := range events {
+			data, err := b.pii.Encrypt(ctx, e)
+			if err != nil {
+				return err
+			}
+			copied := *e
+			copied.Data = data
+			stored[i] = &copied
+		}
+		events = stored
+	}
+
 	b.allEvents[index] = append(existing, events...)
 	return nil
 }
 
 func (b *memoryStore) LoadEvents(ctx context.Context, id, typeName string, fromVersion int) ([]*es.Event, error) {
-	index := fmt.Sprintf("%s.%s", typeName, id)
+	b.RLock()
+	defer b.RUnlock()
 
-	existing := b.allEvents[index]
-	if existing == nil {
-		return []*es.Event{}, nil
-	}
-	if fromVersion < 1 {
-		return existing, nil
-	}
+	index := streamKey(ctx, typeName, id)
 
+	// archived events are older than the live ones
+	existing := append(append([]*es.Event{}, b.allArchived[index]...), b.allEvents[index]...)
 	filteredEvents := []*es.Event{}
 	for _, e := range existing {
-		if e.Version > fromVersion {
-			filteredEvents = append(filteredEvents, e)
+		if e.Version <= fromVersion {
+			continue
 		}
+		if b.pii != nil {
+			copied := *e
+			copied.Data = copyData(e.Data)
+			if err := b.pii.Decrypt(ctx, &copied); err != nil {
+				return nil, err
+			}
+			e = &copied
+		}
+		filteredEvents = append(filteredEvents, e)
 	}
 
 	return filteredEvents, nil
 }
 
+func (b *memoryStore) ArchiveEvents(ctx context.Context, id, typeName string, beforeVersion int) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	index := streamKey(ctx, typeName, id)
+
+	// the last event is kept, it's what SaveEvents checks the version with
+	existing := b.allEvents[index]
+	n := 0
+	for n < len(existing)-1 && existing[n].Version < beforeVersion {
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	b.allArchived[index] = append(b.allArchived[index], existing[:n]...)
+	b.allEvents[index] = append([]*es.Event{}, existing[n:]...)
+	return n, nil
+}
+
 func (b *memoryStore) SaveSnapshot(ctx context.Context, revision string, agg es.Aggregate) error {
 	if agg == nil {
 		return ErrAggregateNil
 	}
 
-	id := agg.GetID() + "_" + revision
-	b.allSnapshots[id] = agg
+	b.Lock()
+	defer b.Unlock()
+
+	snapshots, ok := b.allSnapshots[revision]
+	if !ok {
+		snapshots = make(map[string]es.Aggregate)
+		b.allSnapshots[revision] = snapshots
+	}
+	snapshots[key(ctx, agg)] = clone(agg)
 	return nil
 }
 func (b *memoryStore) LoadSnapshot(ctx context.Context, revision string, agg es.Aggregate) error {
@@ -95,8 +169,10 @@ func (b *memoryStore) LoadSnapshot(ctx context.Context, revision string, agg es.
 		return ErrAggregateNil
 	}
 
-	id := agg.GetID() + "_" + revision
-	if nagg, ok := b.allSnapshots[id]; ok {
+	b.RLock()
+	defer b.RUnlock()
+
+	if nagg, ok := b.allSnapshots[revision][key(ctx, agg)]; ok {
 		set(agg, nagg)
 	}
 	return nil
@@ -106,8 +182,21 @@ func (b *memoryStore) SaveAggregate(ctx context.Context, agg es.Aggregate) error
 		return ErrAggregateNil
 	}
 
-	id := agg.GetID()
-	b.allAggregates[id] = agg
+	b.Lock()
+	defer b.Unlock()
+
+	b.allAggregates[key(ctx, agg)] = clone(agg)
+	return nil
+}
+func (b *memoryStore) DeleteAggregate(ctx context.Context, agg es.Aggregate) error {
+	if agg == nil {
+		return ErrAggregateNil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	delete(b.allAggregates, key(ctx, agg))
 	return nil
 }
 func (b *memoryStore) LoadAggregate(ctx context.Context, agg es.Aggregate) error {
@@ -115,13 +204,69 @@ func (b *memoryStore) LoadAggregate(ctx context.Context, agg es.Aggregate) error
 		return ErrAggregateNil
 	}
 
-	id := agg.GetID()
-	if nagg, ok := b.allAggregates[id]; ok {
+	b.RLock()
+	defer b.RUnlock()
+
+	if nagg, ok := b.allAggregates[key(ctx, agg)]; ok {
 		set(agg, nagg)
 	}
 	return nil
 }
 
+func (b *memoryStore) SnapshotRevisions(ctx context.Context) ([]string, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	tenant := tenantPrefix(ctx)
+	revisions := []string{}
+	for revision, snapshots := range b.allSnapshots {
+		for index := range snapshots {
+			if strings.HasPrefix(index, tenant) {
+				revisions = append(revisions, revision)
+				break
+			}
+		}
+	}
+	sort.Strings(revisions)
+	return revisions, nil
+}
+
+func (b *memoryStore) ListSnapshots(ctx context.Context, revision string) ([]*es.SnapshotRecord, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	tenant := tenantPrefix(ctx)
+	records := []*es.SnapshotRecord{}
+	for index, agg := range b.allSnapshots[revision] {
+		if !strings.HasPrefix(index, tenant) {
+			continue
+		}
+		record := &es.SnapshotRecord{
+			AggregateID:   agg.GetID(),
+			AggregateType: agg.GetTypeName(),
+			Revision:      revision,
+		}
+		if versioned, ok := agg.(interface{ GetVersion() int }); ok {
+			record.Version = versioned.GetVersion()
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (b *memoryStore) DeleteSnapshots(ctx context.Context, revision string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	tenant := tenantPrefix(ctx)
+	for index := range b.allSnapshots[revision] {
+		if strings.HasPrefix(index, tenant) {
+			delete(b.allSnapshots[revision], index)
+		}
+	}
+	return nil
+}
+
 // Close underlying connection
 func (b *memoryStore) Close() error {
 	return nil
@@ -131,3 +276,71 @@ func set(x, y interface{}) {
 	val := reflect.ValueOf(y).Elem()
 	reflect.ValueOf(x).Elem().Set(val)
 }
+
+func clone(agg es.Aggregate) es.Aggregate {
+	val := reflect.ValueOf(agg).Elem()
+	c := reflect.New(val.Type())
+	c.Elem().Set(val)
+	return c.Interface().(es.Aggregate)
+}
+
+// every key starts with the tenant so tenants never see each other's data,
+// it's escaped so a tenant can't contain the prefix of another
+func tenantPrefix(ctx context.Context) string {
+	return url.PathEscape(es.TenantFromContext(ctx)) + "/"
+}
+
+func streamKey(ctx context.Context, typeName, id string) string {
+	return fmt.Sprintf("%s%s.%s", tenantPrefix(ctx), typeName, id)
+}
+
+func key(ctx context.Context, agg es.Aggregate) string {
+	return streamKey(ctx, agg.GetTypeName(), agg.GetID())
+}
+
+func (b *memoryStore) AggregateTypes(ctx context.Context) ([]string, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	seen := make(map[string]bool)
+	typeNames := []string{}
+	tenant := tenantPrefix(ctx)
+	for index := range b.allEvents {
+		if !strings.HasPrefix(index, tenant) {
+			continue
+		}
+		typeName := strings.SplitN(strings.TrimPrefix(index, tenant), ".", 2)[0]
+		if !seen[typeName] {
+			seen[typeName] = true
+			typeNames = append(typeNames, typeName)
+		}
+	}
+	sort.Strings(typeNames)
+	return typeNames, nil
+}
+
+func (b *memoryStore) AggregateIDs(ctx context.Context, typeName string) ([]string, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	prefix := tenantPrefix(ctx) + typeName + "."
+	ids := []string{}
+	for index := range b.allEvents {
+		if strings.HasPrefix(index, prefix) {
+			ids = append(ids, strings.TrimPrefix(index, prefix))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// copyData so decrypting doesn't change the stored event
+func copyData(data interface{}) interface{} {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return data
+	}
+	out := reflect.New(v.Elem().Type())
+	out.Elem().Set(v.Elem())
+	return out.Interface()
+}
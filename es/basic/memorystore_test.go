@@ -0,0 +1,69 @@
+package basic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextgg/go-es/es"
+	"github.com/contextgg/go-es/es/storetest"
+)
+
+type LoggedIn struct {
+	Username string `es:"pii"`
+}
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func(es.EventRegistry) (es.DataStore, error) {
+		return NewMemoryStore(), nil
+	})
+}
+
+func TestMemoryStorePII(t *testing.T) {
+	ctx := context.Background()
+	keys := es.NewMemoryKeyStore()
+	store := NewMemoryStore(WithPII(es.NewPII(keys)))
+
+	evt := &es.Event{
+		Type:          "LoggedIn",
+		AggregateID:   "1",
+		AggregateType: "User",
+		Version:       1,
+		Data:          &LoggedIn{Username: "bob"},
+	}
+	if err := store.SaveEvents(ctx, []*es.Event{evt}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if evt.Data.(*LoggedIn).Username != "bob" {
+		t.Errorf("the saved event was changed")
+	}
+
+	events, err := store.LoadEvents(ctx, "1", "User", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := events[0].Data.(*LoggedIn).Username; got != "bob" {
+		t.Errorf("got %q, want bob", got)
+	}
+
+	keys.DeleteKey(ctx, "1")
+	events, err = store.LoadEvents(ctx, "1", "User", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := events[0].Data.(*LoggedIn).Username; got != "" {
+		t.Errorf("got %q after erasure", got)
+	}
+}
+
+func TestEncryptedMemoryStore(t *testing.T) {
+	keyring, err := es.NewKeyring("k1", map[string][]byte{
+		"k1": make([]byte, 32),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storetest.Run(t, func(r es.EventRegistry) (es.DataStore, error) {
+		return es.NewEncryptedStore(NewMemoryStore(), keyring, r.Get), nil
+	})
+}
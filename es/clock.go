@@ -0,0 +1,93 @@
+package es
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock tells the time used for event timestamps
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is a function that can be used as a clock.
+type ClockFunc func() time.Time
+
+// Now implements the Now method of the Clock.
+func (c ClockFunc) Now() time.Time {
+	return c()
+}
+
+// SystemClock is the wall clock in UTC
+func SystemClock() Clock {
+	return ClockFunc(func() time.Time {
+		return time.Now().UTC()
+	})
+}
+
+type clockKey struct{}
+
+// WithClock returns a context carrying the clock
+func WithClock(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, clock)
+}
+
+// ClockFromContext returns the clock of the context or the system clock
+func ClockFromContext(ctx context.Context) Clock {
+	if clock, ok := ctx.Value(clockKey{}).(Clock); ok && clock != nil {
+		return clock
+	}
+	return SystemClock()
+}
+
+// Now returns the time of the clock in the context, in UTC
+func Now(ctx context.Context) time.Time {
+	return ClockFromContext(ctx).Now().UTC()
+}
+
+// ClockMiddleware puts the clock in the context of every command, unless
+// the caller already set one
+func ClockMiddleware(clock Clock) CommandHandlerMiddleware {
+	return func(h CommandHandler) CommandHandler {
+		return CommandHandlerFunc(func(ctx context.Context, cmd Command) error {
+			if _, ok := ctx.Value(clockKey{}).(Clock); !ok {
+				ctx = WithClock(ctx, clock)
+			}
+			return h.HandleCommand(ctx, cmd)
+		})
+	}
+}
+
+// FakeClock is a clock that only moves when told to, for tests
+type FakeClock struct {
+	sync.RWMutex
+
+	now time.Time
+}
+
+// NewFakeClock creates a clock stopped at t
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t.UTC()}
+}
+
+// Now returns the current time of the clock
+func (c *FakeClock) Now() time.Time {
+	c.RLock()
+	defer c.RUnlock()
+	return c.now
+}
+
+// Set moves the clock to t
+func (c *FakeClock) Set(t time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = t.UTC()
+}
+
+// Advance moves the clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+}
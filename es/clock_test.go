@@ -0,0 +1,124 @@
+package es
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type RecordingDataStore struct {
+	TestDataStore
+
+	events []*Event
+}
+
+func (d *RecordingDataStore) SaveEvents(ctx context.Context, events []*Event, version int) error {
+	d.events = append(d.events, events...)
+	return nil
+}
+
+// TickCommand for testing
+type TickCommand struct {
+	BaseCommand
+}
+
+// ClockAggregate stores an event for every command
+type ClockAggregate struct {
+	BaseAggregateSourced
+}
+
+func (a *ClockAggregate) HandleCommand(ctx context.Context, cmd Command) error {
+	a.StoreEvent(&EventTested{"tick"})
+	return nil
+}
+func (a *ClockAggregate) ApplyEvent(context.Context, interface{}) error {
+	return nil
+}
+
+func TestClockFromContext(t *testing.T) {
+	if loc := Now(context.Background()).Location(); loc != time.UTC {
+		t.Errorf("got %v, want UTC", loc)
+	}
+
+	clock := NewFakeClock(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	ctx := WithClock(context.Background(), clock)
+
+	clock.Advance(time.Minute)
+	if got, want := Now(ctx), time.Date(2020, 1, 2, 3, 5, 5, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestClockMiddlewareKeepsCallerClock(t *testing.T) {
+	caller := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	builder := NewFakeClock(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	var got time.Time
+	h := ClockMiddleware(builder)(CommandHandlerFunc(func(ctx context.Context, cmd Command) error {
+		got = Now(ctx)
+		return nil
+	}))
+
+	h.HandleCommand(context.Background(), &ReplayCommand{})
+	if !got.Equal(builder.Now()) {
+		t.Errorf("got %v, want %v", got, builder.Now())
+	}
+
+	h.HandleCommand(WithClock(context.Background(), caller), &ReplayCommand{})
+	if !got.Equal(caller.Now()) {
+		t.Errorf("got %v, want %v", got, caller.Now())
+	}
+}
+
+func TestAggregateHandlerTimestamps(t *testing.T) {
+	store := &RecordingDataStore{}
+	factory := NewAggregateSourcedFactory(NewAggregateSourcedFunc(&ClockAggregate{}))
+	handler := NewAggregateHandler(factory, store, &TestBus{}, "", nil, false)
+
+	clock := NewFakeClock(time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600)))
+	ctx := WithClock(context.Background(), clock)
+
+	cmd := &TickCommand{BaseCommand{AggregateID: "1"}}
+	if err := handler.HandleCommand(ctx, cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.events) != 1 {
+		t.Fatalf("got %d events, want 1", len(store.events))
+	}
+	if ts := store.events[0].Timestamp; !ts.Equal(clock.Now()) || ts.Location() != time.UTC {
+		t.Errorf("got %v, want %v", ts, clock.Now())
+	}
+}
+
+func TestAggregateStoreTimestamps(t *testing.T) {
+	bus := &RecordingBus{}
+	store := NewAggregateStore(nil, &TestDataStore{}, bus)
+
+	clock := NewFakeClock(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	ctx := WithClock(context.Background(), clock)
+
+	aggregate := &TestAggregate{}
+	aggregate.PublishEvent(NewEvent(&EventTested{"Hello"}))
+	if err := store.SaveAggregate(ctx, aggregate); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bus.events) != 1 {
+		t.Fatalf("got %d events, want 1", len(bus.events))
+	}
+	if ts := bus.events[0].Timestamp; !ts.Equal(clock.Now()) {
+		t.Errorf("got %v, want %v", ts, clock.Now())
+	}
+}
+
+type RecordingBus struct {
+	TestBus
+
+	events []*Event
+}
+
+func (b *RecordingBus) HandleEvent(ctx context.Context, event *Event) error {
+	b.events = append(b.events, event)
+	return nil
+}
@@ -25,6 +25,31 @@ type SettableID interface {
 	SetID(string)
 }
 
+// ExpectedVersion is implemented by commands that only apply to the version of
+// the aggregate the client last saw, ok is false to skip the check
+type ExpectedVersion interface {
+	GetExpectedVersion() (version int, ok bool)
+}
+
+// BaseVersionedCommand is a BaseCommand carrying the expected version
+type BaseVersionedCommand struct {
+	BaseCommand
+	ExpectedVersion *int `json:"expected_version,omitempty"`
+}
+
+// GetExpectedVersion returns the version the client expects, if any
+func (c *BaseVersionedCommand) GetExpectedVersion() (int, bool) {
+	if c.ExpectedVersion == nil {
+		return 0, false
+	}
+	return *c.ExpectedVersion, true
+}
+
+// SetExpectedVersion so gateways can set it from the request
+func (c *BaseVersionedCommand) SetExpectedVersion(version int) {
+	c.ExpectedVersion = &version
+}
+
 // ReplayCommand a command that load and reply events ontop of an aggregate.
 type ReplayCommand struct {
 	BaseCommand
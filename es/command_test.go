@@ -0,0 +1,43 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// VersionedTickCommand for testing
+type VersionedTickCommand struct {
+	BaseVersionedCommand
+}
+
+func TestAggregateHandlerExpectedVersion(t *testing.T) {
+	store := &RecordingDataStore{}
+	factory := NewAggregateSourcedFactory(NewAggregateSourcedFunc(&ClockAggregate{}))
+	handler := NewAggregateHandler(factory, store, &TestBus{}, "", nil, false)
+
+	cmd := &VersionedTickCommand{}
+	cmd.SetID("1")
+	if err := handler.HandleCommand(context.Background(), cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd.SetExpectedVersion(0)
+	if err := handler.HandleCommand(context.Background(), cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd.SetExpectedVersion(2)
+	err := handler.HandleCommand(context.Background(), cmd)
+	if !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("expected %v, got %v", ErrVersionMismatch, err)
+	}
+
+	var conflict *VersionConflictError
+	if !errors.As(err, &conflict) || conflict.Expected != 2 || conflict.Actual != 0 {
+		t.Errorf("got %#v", err)
+	}
+	if len(store.events) != 2 {
+		t.Errorf("got %d events, want 2", len(store.events))
+	}
+}
@@ -8,6 +8,7 @@ import (
 type CommandBus interface {
 	CommandRegistry
 	CommandHandler
+	CommandResultHandler
 }
 
 // NewCommandBus create a new bus from a registry
@@ -29,3 +30,8 @@ func (b *commandBus) HandleCommand(ctx context.Context, cmd Command) error {
 	}
 	return handler.HandleCommand(ctx, cmd)
 }
+
+// HandleCommandWithResult handles the command and returns its result
+func (b *commandBus) HandleCommandWithResult(ctx context.Context, cmd Command) (*CommandResult, error) {
+	return HandleCommandWithResult(ctx, b, cmd)
+}
@@ -8,6 +8,9 @@ import (
 	"sync"
 )
 
+// ErrCommandNotFound when no command is registered under a name
+var ErrCommandNotFound = errors.New("Command not found")
+
 // CommandRegistry stores the handlers for commands
 type CommandRegistry interface {
 	SetHandler(CommandHandler, Command) error
@@ -48,6 +51,9 @@ func (r *commandRegistry) GetHandler(cmd Command) (CommandHandler, error) {
 		return nil, errors.New("You need to supply a command")
 	}
 
+	r.RLock()
+	defer r.RUnlock()
+
 	_, name := GetTypeName(cmd)
 	handler, ok := r.registry[name]
 	if !ok {
@@ -57,6 +63,9 @@ func (r *commandRegistry) GetHandler(cmd Command) (CommandHandler, error) {
 }
 
 func (r *commandRegistry) NewCommand(name string) (Command, error) {
+	r.RLock()
+	defer r.RUnlock()
+
 	for key, value := range r.types {
 
 		if isCommandMatch(key, name) {
@@ -64,7 +73,7 @@ func (r *commandRegistry) NewCommand(name string) (Command, error) {
 			return i.(Command), nil
 		}
 	}
-	return nil, fmt.Errorf("Cannot find %s in registry", name)
+	return nil, fmt.Errorf("%w: cannot find %s in registry", ErrCommandNotFound, name)
 }
 
 func isCommandMatch(key, name string) bool {
@@ -0,0 +1,57 @@
+package es
+
+import "context"
+
+// CommandResult is what handling a command did to its aggregate
+type CommandResult struct {
+	AggregateID string
+	// Version of the aggregate once the events were committed
+	Version int
+	// Events committed by the command, empty when nothing changed
+	Events []*Event
+}
+
+// CommandResultHandler handles a command and returns its result
+type CommandResultHandler interface {
+	HandleCommandWithResult(context.Context, Command) (*CommandResult, error)
+}
+
+type commandResultKey struct{}
+
+// WithCommandResult returns a context in which the first aggregate handling a
+// command records its result, commands dispatched further down by sagas
+// don't overwrite it
+func WithCommandResult(ctx context.Context) (context.Context, *CommandResult) {
+	result := &CommandResult{}
+	return context.WithValue(ctx, commandResultKey{}, result), result
+}
+
+// CommandResultFromContext returns the result to fill in, or nil
+func CommandResultFromContext(ctx context.Context) *CommandResult {
+	result, _ := ctx.Value(commandResultKey{}).(*CommandResult)
+	return result
+}
+
+// claimCommandResult takes the result out of ctx so nested commands can't
+// record theirs into it
+func claimCommandResult(ctx context.Context) (context.Context, *CommandResult) {
+	result := CommandResultFromContext(ctx)
+	if result == nil {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, commandResultKey{}, nil), result
+}
+
+// HandleCommandWithResult handles the command with h and returns the result
+// recorded by the aggregate. Handlers that don't record one, like sagas or
+// remote services, leave the version at 0.
+func HandleCommandWithResult(ctx context.Context, h CommandHandler, cmd Command) (*CommandResult, error) {
+	ctx, result := WithCommandResult(ctx)
+	if err := h.HandleCommand(ctx, cmd); err != nil {
+		return nil, err
+	}
+	if len(result.AggregateID) == 0 {
+		result.AggregateID = cmd.GetAggregateID()
+	}
+	return result, nil
+}
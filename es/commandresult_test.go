@@ -0,0 +1,57 @@
+package es
+
+import (
+	"context"
+	"testing"
+)
+
+// SagaBus dispatches a command for every event, like a saga would
+type SagaBus struct {
+	TestBus
+
+	handler CommandHandler
+}
+
+func (b *SagaBus) HandleEvent(ctx context.Context, evt *Event) error {
+	if evt.AggregateID != "1" {
+		return nil
+	}
+	return b.handler.HandleCommand(ctx, &TickCommand{BaseCommand{AggregateID: "2"}})
+}
+
+func TestHandleCommandWithResult(t *testing.T) {
+	store := &RecordingDataStore{}
+	factory := NewAggregateSourcedFactory(NewAggregateSourcedFunc(&ClockAggregate{}))
+	bus := &SagaBus{}
+	handler := NewAggregateHandler(factory, store, bus, "", nil, false)
+	bus.handler = handler
+
+	result, err := HandleCommandWithResult(context.Background(), handler, &TickCommand{BaseCommand{AggregateID: "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.events) != 2 {
+		t.Fatalf("got %d stored events, want 2", len(store.events))
+	}
+	if result.AggregateID != "1" || result.Version != 1 {
+		t.Errorf("got result %+v", result)
+	}
+	if len(result.Events) != 1 || result.Events[0] != store.events[0] {
+		t.Errorf("got events %v", result.Events)
+	}
+}
+
+func TestHandleCommandWithResultWithoutAggregate(t *testing.T) {
+	handler := CommandHandlerFunc(func(context.Context, Command) error {
+		return nil
+	})
+
+	result, err := HandleCommandWithResult(context.Background(), handler, &TickCommand{BaseCommand{AggregateID: "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.AggregateID != "1" || result.Version != 0 || len(result.Events) != 0 {
+		t.Errorf("got result %+v", result)
+	}
+}
@@ -2,8 +2,31 @@ package es
 
 import (
 	"context"
+	"errors"
+	"fmt"
 )
 
+// ErrVersionMismatch when the stored version doesn't match the expected one
+var ErrVersionMismatch = errors.New("Aggregate version mismatch")
+
+// VersionConflictError when a command expected another version of the
+// aggregate, it matches ErrVersionMismatch with errors.Is
+type VersionConflictError struct {
+	AggregateID   string
+	AggregateType string
+	Expected      int
+	Actual        int
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%s: %s %s is at version %d, expected %d", ErrVersionMismatch, e.AggregateType, e.AggregateID, e.Actual, e.Expected)
+}
+
+// Is lets errors.Is match ErrVersionMismatch
+func (e *VersionConflictError) Is(target error) bool {
+	return target == ErrVersionMismatch
+}
+
 // DataStore in charge of saving and loading events and aggregates from a data store
 type DataStore interface {
 	SaveEvents(context.Context, []*Event, int) error
@@ -14,3 +37,28 @@ type DataStore interface {
 	LoadAggregate(context.Context, Aggregate) error
 	Close() error
 }
+
+// Unwrapper is implemented by datastores that decorate another one, the
+// optional interfaces of the inner store stay reachable through AsStore
+type Unwrapper interface {
+	Unwrap() DataStore
+}
+
+// AsStore returns the first datastore of the decorator chain implementing
+// T, like errors.As does for errors. A decorator that has to change how a
+// capability behaves implements it itself.
+func AsStore[T any](dataStore DataStore) (T, bool) {
+	for dataStore != nil {
+		if store, ok := dataStore.(T); ok {
+			return store, true
+		}
+		u, ok := dataStore.(Unwrapper)
+		if !ok {
+			break
+		}
+		dataStore = u.Unwrap()
+	}
+
+	var zero T
+	return zero, false
+}
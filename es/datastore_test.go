@@ -0,0 +1,83 @@
+package es
+
+import (
+	"context"
+	"testing"
+)
+
+// CapableDataStore implements every optional datastore interface
+type CapableDataStore struct {
+	TestDataStore
+
+	deleted int
+}
+
+func (d *CapableDataStore) SnapshotRevisions(context.Context) ([]string, error) {
+	return nil, nil
+}
+func (d *CapableDataStore) ListSnapshots(context.Context, string) ([]*SnapshotRecord, error) {
+	return nil, nil
+}
+func (d *CapableDataStore) DeleteSnapshots(context.Context, string) error {
+	return nil
+}
+func (d *CapableDataStore) AggregateTypes(context.Context) ([]string, error) {
+	return nil, nil
+}
+func (d *CapableDataStore) AggregateIDs(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+func (d *CapableDataStore) DeleteAggregate(context.Context, Aggregate) error {
+	d.deleted++
+	return nil
+}
+func (d *CapableDataStore) ArchiveEvents(context.Context, string, string, int) (int, error) {
+	return 0, nil
+}
+func (d *CapableDataStore) LoadEventStream(context.Context, string, string, int) (EventStream, error) {
+	return NewEventStream(nil), nil
+}
+
+func reachable[T any](t *testing.T, dataStore DataStore, want interface{}) {
+	t.Helper()
+
+	got, ok := AsStore[T](dataStore)
+	if !ok {
+		t.Errorf("%T is not reachable", (*T)(nil))
+		return
+	}
+	if interface{}(got) != want {
+		t.Errorf("%T reached %T, want %T", (*T)(nil), got, want)
+	}
+}
+
+func TestAsStoreThroughDecorators(t *testing.T) {
+	inner := &CapableDataStore{}
+	keyring := newTestKeyring(t, "a", "a")
+	encrypted := NewEncryptedStore(inner, keyring, EncryptedEventData)
+
+	stores := map[string]DataStore{
+		"async":           NewAsyncSnapshotStore(inner),
+		"encrypted":       encrypted,
+		"async encrypted": NewAsyncSnapshotStore(encrypted),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			reachable[SnapshotStore](t, store, inner)
+			reachable[StreamStore](t, store, inner)
+			reachable[AggregateDeleter](t, store, inner)
+			reachable[ArchiveStore](t, store, inner)
+
+			// the encrypted store streams events itself to decrypt them
+			if name == "async" {
+				reachable[EventStreamStore](t, store, inner)
+			} else {
+				reachable[EventStreamStore](t, store, encrypted)
+			}
+		})
+	}
+
+	if _, ok := AsStore[SnapshotStore](&TestDataStore{}); ok {
+		t.Error("TestDataStore is not a SnapshotStore")
+	}
+}
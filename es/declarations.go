@@ -0,0 +1,62 @@
+package es
+
+import (
+	"reflect"
+	"sort"
+)
+
+// CommandDeclarer is implemented by aggregates that declare the commands they handle
+type CommandDeclarer interface {
+	DeclaredCommands() []Command
+}
+
+// EventDeclarer is implemented by aggregates that declare the events they store and apply
+type EventDeclarer interface {
+	DeclaredEvents() []interface{}
+}
+
+// DeclaredCommands returns the commands an aggregate handles, ok is false
+// when it doesn't declare them. Aggregates embedding BaseAggregateRouted
+// declare their Handle methods.
+func DeclaredCommands(aggregate AggregateSourced) ([]Command, bool) {
+	if d, ok := aggregate.(CommandDeclarer); ok {
+		return d.DeclaredCommands(), true
+	}
+	if _, ok := aggregate.(routedAggregate); ok {
+		var commands []Command
+		for _, t := range routesFor(reflect.TypeOf(aggregate)).commands.types() {
+			commands = append(commands, newInstance(t).(Command))
+		}
+		return commands, true
+	}
+	return nil, false
+}
+
+// DeclaredEvents returns the events an aggregate applies, ok is false when
+// it doesn't declare them. Aggregates embedding BaseAggregateRouted declare
+// their Apply methods.
+func DeclaredEvents(aggregate AggregateSourced) ([]interface{}, bool) {
+	if d, ok := aggregate.(EventDeclarer); ok {
+		return d.DeclaredEvents(), true
+	}
+	if _, ok := aggregate.(routedAggregate); ok {
+		var events []interface{}
+		for _, t := range routesFor(reflect.TypeOf(aggregate)).events.types() {
+			events = append(events, newInstance(t))
+		}
+		return events, true
+	}
+	return nil, false
+}
+
+// types returns the argument types of the table sorted by name
+func (t methodTable) types() []reflect.Type {
+	types := make([]reflect.Type, 0, len(t))
+	for k := range t {
+		types = append(types, k)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].String() < types[j].String()
+	})
+	return types
+}
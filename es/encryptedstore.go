@@ -0,0 +1,287 @@
+package es
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// ErrUnknownKey when a record was encrypted with a key missing from the keyring
+var ErrUnknownKey = errors.New("Unknown encryption key")
+
+// Keyring holds the key encryption keys by ID, new records use the primary
+// one. Rotate by adding a key and making it primary, older keys are only
+// needed to read what they encrypted.
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// NewKeyring creates a keyring, every key must be 16, 24 or 32 bytes
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, primary)
+	}
+	for id, key := range keys {
+		if _, err := newGCM(key); err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+	}
+	return &Keyring{
+		primary: primary,
+		keys:    keys,
+	}, nil
+}
+
+// EncryptedData is a payload encrypted with its own data key, the data key
+// is encrypted with the keyring key KeyID
+type EncryptedData struct {
+	KeyID      string `json:"key_id" bson:"key_id"`
+	DataKey    []byte `json:"data_key" bson:"data_key"`
+	Ciphertext []byte `json:"ciphertext" bson:"ciphertext"`
+}
+
+// EncryptedEventData is the es.EventDataFactory the store under an
+// encrypted store decodes with, every payload is an EncryptedData
+func EncryptedEventData(string) (interface{}, error) {
+	return &EncryptedData{}, nil
+}
+
+// EncryptedSnapshot is what the store under an encrypted store saves as the
+// snapshot of an aggregate
+type EncryptedSnapshot struct {
+	ID       string         `json:"id" bson:"id"`
+	TypeName string         `json:"type_name" bson:"type_name"`
+	Version  int            `json:"version" bson:"version"`
+	Data     *EncryptedData `json:"data" bson:"data"`
+}
+
+// Initialize the snapshot with id and type
+func (s *EncryptedSnapshot) Initialize(id string, typeName string) {
+	s.ID = id
+	s.TypeName = typeName
+}
+
+// GetID of the aggregate
+func (s *EncryptedSnapshot) GetID() string {
+	return s.ID
+}
+
+// GetTypeName of the aggregate
+func (s *EncryptedSnapshot) GetTypeName() string {
+	return s.TypeName
+}
+
+// GetVersion of the aggregate when the snapshot was taken
+func (s *EncryptedSnapshot) GetVersion() int {
+	return s.Version
+}
+
+func (k *Keyring) seal(v interface{}, aad string) (*EncryptedData, error) {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := sealGCM(dataKey, plain, aad)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := sealGCM(k.keys[k.primary], dataKey, aad)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedData{
+		KeyID:      k.primary,
+		DataKey:    wrapped,
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+func (k *Keyring) open(data *EncryptedData, v interface{}, aad string) error {
+	key, ok := k.keys[data.KeyID]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownKey, data.KeyID)
+	}
+	dataKey, err := openGCM(key, data.DataKey, aad)
+	if err != nil {
+		return err
+	}
+	plain, err := openGCM(dataKey, data.Ciphertext, aad)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plain, v)
+}
+
+func sealGCM(key []byte, plain []byte, aad string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, []byte(aad)), nil
+}
+
+func openGCM(key []byte, sealed []byte, aad string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(aad))
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plain, nil
+}
+
+// NewEncryptedStore wraps a datastore so event payloads and snapshots are
+// encrypted with AES-GCM before they reach it. Payloads are decoded with
+// factory, the wrapped store must decode them with EncryptedEventData.
+// What gets encrypted is encoded with encoding/json and not the codec of the
+// wrapped store, so payloads and aggregates need to survive a JSON round
+// trip, their bson tags are ignored. Records are bound to their stream and
+// tenant, one moved elsewhere doesn't decrypt. Projections are left readable.
+func NewEncryptedStore(dataStore DataStore, keyring *Keyring, factory EventDataFactory) DataStore {
+	return &encryptedStore{
+		DataStore: dataStore,
+		keyring:   keyring,
+		factory:   factory,
+	}
+}
+
+type encryptedStore struct {
+	DataStore
+
+	keyring *Keyring
+	factory EventDataFactory
+}
+
+// the additional data binds a record to where it's stored, records without
+// a tenant keep the data they were first encrypted with
+func eventAAD(ctx context.Context, e *Event) string {
+	return tenantAAD(ctx) + fmt.Sprintf("%s.%s.%d", e.AggregateType, e.AggregateID, e.Version)
+}
+
+func snapshotAAD(ctx context.Context, revision string, aggregate Aggregate) string {
+	return tenantAAD(ctx) + fmt.Sprintf("%s.%s.%s", aggregate.GetTypeName(), aggregate.GetID(), revision)
+}
+
+func tenantAAD(ctx context.Context) string {
+	if tenant := TenantFromContext(ctx); len(tenant) > 0 {
+		return url.PathEscape(tenant) + "/"
+	}
+	return ""
+}
+
+func (s *encryptedStore) SaveEvents(ctx context.Context, events []*Event, version int) error {
+	encrypted := make([]*Event, len(events))
+	for i, e := range events {
+		copied := *e
+		if e.Data != nil {
+			data, err := s.keyring.seal(e.Data, eventAAD(ctx, e))
+			if err != nil {
+				return err
+			}
+			copied.Data = data
+		}
+		encrypted[i] = &copied
+	}
+	return s.DataStore.SaveEvents(ctx, encrypted, version)
+}
+
+func (s *encryptedStore) LoadEvents(ctx context.Context, id string, typeName string, fromVersion int) ([]*Event, error) {
+	events, err := s.DataStore.LoadEvents(ctx, id, typeName, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := make([]*Event, len(events))
+	for i, e := range events {
+		if decrypted[i], err = s.decrypt(ctx, e); err != nil {
+			return nil, err
+		}
+	}
+	return decrypted, nil
+}
+
+func (s *encryptedStore) LoadEventStream(ctx context.Context, id string, typeName string, fromVersion int) (EventStream, error) {
+	stream, err := LoadEventStream(ctx, s.DataStore, id, typeName, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+	decrypt := func(e *Event) (*Event, error) {
+		return s.decrypt(ctx, e)
+	}
+	return &mapStream{EventStream: stream, fn: decrypt}, nil
+}
+
+// decrypt returns a copy of the event with its payload decrypted
+func (s *encryptedStore) decrypt(ctx context.Context, e *Event) (*Event, error) {
+	copied := *e
+	if encrypted, ok := e.Data.(*EncryptedData); ok {
+		data, err := s.factory(e.Type)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.keyring.open(encrypted, data, eventAAD(ctx, e)); err != nil {
+			return nil, err
+		}
+		copied.Data = data
+	}
+	return &copied, nil
+}
+
+func (s *encryptedStore) SaveSnapshot(ctx context.Context, revision string, aggregate Aggregate) error {
+	data, err := s.keyring.seal(aggregate, snapshotAAD(ctx, revision, aggregate))
+	if err != nil {
+		return err
+	}
+
+	snapshot := &EncryptedSnapshot{
+		ID:       aggregate.GetID(),
+		TypeName: aggregate.GetTypeName(),
+		Data:     data,
+	}
+	if sourced, ok := aggregate.(AggregateSourced); ok {
+		snapshot.Version = sourced.GetVersion()
+	}
+	return s.DataStore.SaveSnapshot(ctx, revision, snapshot)
+}
+
+func (s *encryptedStore) LoadSnapshot(ctx context.Context, revision string, aggregate Aggregate) error {
+	snapshot := &EncryptedSnapshot{
+		ID:       aggregate.GetID(),
+		TypeName: aggregate.GetTypeName(),
+	}
+	if err := s.DataStore.LoadSnapshot(ctx, revision, snapshot); err != nil {
+		return err
+	}
+
+	// no snapshot leaves the aggregate untouched
+	if snapshot.Data == nil {
+		return nil
+	}
+	return s.keyring.open(snapshot.Data, aggregate, snapshotAAD(ctx, revision, aggregate))
+}
+
+// Unwrap returns the store the encrypted records are saved to, only the
+// event payloads and snapshots are encrypted so its other capabilities are
+// used as they are
+func (s *encryptedStore) Unwrap() DataStore {
+	return s.DataStore
+}
@@ -0,0 +1,106 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func newTestKeyring(t *testing.T, primary string, ids ...string) *Keyring {
+	keys := make(map[string][]byte)
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id[:1]), 32)
+	}
+	keyring, err := NewKeyring(primary, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+func TestEncryptedStoreRotation(t *testing.T) {
+	ctx := context.Background()
+	inner := &EventLogStore{}
+	factory := func(string) (interface{}, error) {
+		return &EventTested{}, nil
+	}
+
+	old := NewEncryptedStore(inner, newTestKeyring(t, "a", "a"), factory)
+	first := &Event{Type: "EventTested", AggregateID: "1", AggregateType: "Test", Version: 1, Data: &EventTested{"secret"}}
+	if err := old.SaveEvents(ctx, []*Event{first}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, ok := inner.events[0].Data.(*EncryptedData)
+	if !ok || stored.KeyID != "a" || bytes.Contains(stored.Ciphertext, []byte("secret")) {
+		t.Fatalf("expected encrypted data at rest, got %#v", inner.events[0].Data)
+	}
+	if first.Data.(*EventTested).Msg != "secret" {
+		t.Errorf("the saved event was changed")
+	}
+
+	rotated := NewEncryptedStore(inner, newTestKeyring(t, "b", "a", "b"), factory)
+	second := &Event{Type: "EventTested", AggregateID: "1", AggregateType: "Test", Version: 2, Data: &EventTested{"newer"}}
+	if err := rotated.SaveEvents(ctx, []*Event{second}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if id := inner.events[1].Data.(*EncryptedData).KeyID; id != "b" {
+		t.Errorf("got key %s, want b", id)
+	}
+
+	events, err := rotated.LoadEvents(ctx, "1", "Test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Data.(*EventTested).Msg != "secret" || events[1].Data.(*EventTested).Msg != "newer" {
+		t.Errorf("got %v", events)
+	}
+
+	retired := NewEncryptedStore(inner, newTestKeyring(t, "b", "b"), factory)
+	if _, err := retired.LoadEvents(ctx, "1", "Test", 0); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected %v, got %v", ErrUnknownKey, err)
+	}
+}
+
+func TestEncryptedStoreMovedRecord(t *testing.T) {
+	ctx := context.Background()
+	inner := &EventLogStore{}
+	store := NewEncryptedStore(inner, newTestKeyring(t, "a", "a"), func(string) (interface{}, error) {
+		return &EventTested{}, nil
+	})
+
+	evt := &Event{Type: "EventTested", AggregateID: "1", AggregateType: "Test", Version: 1, Data: &EventTested{"secret"}}
+	if err := store.SaveEvents(ctx, []*Event{evt}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// a payload copied to another stream doesn't decrypt
+	inner.events[0].AggregateID = "2"
+	if _, err := store.LoadEvents(ctx, "2", "Test", 0); err != ErrInvalidCiphertext {
+		t.Errorf("expected %v, got %v", ErrInvalidCiphertext, err)
+	}
+}
+
+func TestEncryptedStoreMovedTenant(t *testing.T) {
+	ctx := WithTenant(context.Background(), "acme")
+	inner := &EventLogStore{}
+	store := NewEncryptedStore(inner, newTestKeyring(t, "a", "a"), func(string) (interface{}, error) {
+		return &EventTested{}, nil
+	})
+
+	evt := &Event{Type: "EventTested", AggregateID: "1", AggregateType: "Test", Version: 1, Data: &EventTested{"secret"}}
+	if err := store.SaveEvents(ctx, []*Event{evt}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.LoadEvents(ctx, "1", "Test", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same stream of another tenant doesn't decrypt
+	for _, other := range []context.Context{context.Background(), WithTenant(ctx, "globex")} {
+		if _, err := store.LoadEvents(other, "1", "Test", 0); err != ErrInvalidCiphertext {
+			t.Errorf("tenant %q: expected %v, got %v", TenantFromContext(other), ErrInvalidCiphertext, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package estest provides Given/When/Then harnesses to test aggregates and
+// sagas without wiring a builder or a datastore.
+package estest
+
+import (
+	"context"
+	"errors"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/contextgg/go-es/es"
+)
+
+// errSetup when the scenario itself is broken, the failure is already reported
+var errSetup = errors.New("Scenario setup failed")
+
+// T is the part of testing.TB the harnesses need
+type T interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AggregateTest drives an aggregate through past events and a command
+type AggregateTest struct {
+	t       T
+	factory es.AggregateSourcedFactory
+	given   []interface{}
+	cmd     es.Command
+}
+
+// Aggregate starts a test for the aggregate type
+func Aggregate(t T, aggregate es.Aggregate) *AggregateTest {
+	fn := es.NewAggregateSourcedFunc(aggregate)
+	return &AggregateTest{
+		t:       t,
+		factory: es.NewAggregateSourcedFactory(fn),
+	}
+}
+
+// Given are the events already applied to the aggregate
+func (a *AggregateTest) Given(events ...interface{}) *AggregateTest {
+	a.given = append(a.given, events...)
+	return a
+}
+
+// When is the command handled by the aggregate
+func (a *AggregateTest) When(cmd es.Command) *AggregateTest {
+	a.cmd = cmd
+	return a
+}
+
+// Then asserts the command succeeded and produced the events
+func (a *AggregateTest) Then(events ...interface{}) {
+	a.t.Helper()
+
+	produced, err := a.run()
+	if err == errSetup {
+		return
+	}
+	if err != nil {
+		a.t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if len(events) == 0 {
+		events = []interface{}{}
+	}
+	assert.Equal(a.t, events, produced, "Produced events don't match")
+}
+
+// ThenError asserts the command failed with the error, any error is
+// accepted when err is nil
+func (a *AggregateTest) ThenError(err error) {
+	a.t.Helper()
+
+	_, got := a.run()
+	switch {
+	case got == errSetup:
+	case got == nil:
+		a.t.Errorf("Expected an error, got none")
+	case err != nil && !errors.Is(got, err):
+		a.t.Errorf("Expected error %v, got %v", err, got)
+	}
+}
+
+func (a *AggregateTest) run() ([]interface{}, error) {
+	a.t.Helper()
+
+	if a.cmd == nil {
+		a.t.Errorf("No command, call When before Then")
+		return nil, errSetup
+	}
+
+	ctx := context.Background()
+	aggregate, err := a.factory(a.cmd.GetAggregateID())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range a.given {
+		if err := es.ApplyEvent(ctx, aggregate, e); err != nil {
+			a.t.Errorf("Could not apply given event %T: %v", e, err)
+			return nil, errSetup
+		}
+	}
+
+	if err := es.CheckLifecycle(aggregate, a.cmd); err != nil {
+		return nil, err
+	}
+	if err := aggregate.HandleCommand(ctx, a.cmd); err != nil {
+		return nil, err
+	}
+
+	produced := []interface{}{}
+	for _, e := range aggregate.Events() {
+		if err := es.ApplyEvent(ctx, aggregate, e.Data); err != nil {
+			a.t.Errorf("Could not apply produced event %s: %v", e, err)
+		}
+		produced = append(produced, e.Data)
+	}
+	return produced, nil
+}
+
+// SagaTest drives a saga with an event
+type SagaTest struct {
+	t     T
+	saga  es.Saga
+	event *es.Event
+}
+
+// Saga starts a test for the saga
+func Saga(t T, saga es.Saga) *SagaTest {
+	return &SagaTest{
+		t:    t,
+		saga: saga,
+	}
+}
+
+// Given is the event the saga runs on, either an *es.Event or its data
+func (s *SagaTest) Given(event interface{}) *SagaTest {
+	if e, ok := event.(*es.Event); ok {
+		s.event = e
+		return s
+	}
+	s.event = es.NewEvent(event)
+	return s
+}
+
+// Then asserts the saga succeeded and returned the commands
+func (s *SagaTest) Then(cmds ...es.Command) {
+	s.t.Helper()
+
+	got, err := s.run()
+	if err == errSetup {
+		return
+	}
+	if err != nil {
+		s.t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if len(cmds) == 0 {
+		cmds = []es.Command{}
+	}
+	if got == nil {
+		got = []es.Command{}
+	}
+	assert.Equal(s.t, cmds, got, "Returned commands don't match")
+}
+
+// ThenError asserts the saga failed with the error, any error is accepted
+// when err is nil
+func (s *SagaTest) ThenError(err error) {
+	s.t.Helper()
+
+	_, got := s.run()
+	switch {
+	case got == errSetup:
+	case got == nil:
+		s.t.Errorf("Expected an error, got none")
+	case err != nil && !errors.Is(got, err):
+		s.t.Errorf("Expected error %v, got %v", err, got)
+	}
+}
+
+func (s *SagaTest) run() ([]es.Command, error) {
+	s.t.Helper()
+
+	if s.event == nil {
+		s.t.Errorf("No event, call Given before Then")
+		return nil, errSetup
+	}
+	return s.saga.Run(context.Background(), s.event)
+}
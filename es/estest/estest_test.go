@@ -0,0 +1,149 @@
+package estest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/contextgg/go-es/es"
+)
+
+var ErrAlreadyLoggedIn = errors.New("Already logged in")
+
+type LoggedIn struct {
+	Username string
+}
+type LoggedOut struct{}
+
+// Auth aggregate
+type Auth struct {
+	es.BaseAggregateSourced
+
+	Username string
+	LoggedIn bool
+}
+
+func (a *Auth) HandleCommand(ctx context.Context, cmd es.Command) error {
+	switch c := cmd.(type) {
+	case *Login:
+		if a.LoggedIn {
+			return ErrAlreadyLoggedIn
+		}
+		a.StoreEvent(&LoggedIn{Username: c.Username})
+	case *Logout:
+		if a.LoggedIn {
+			a.StoreEvent(&LoggedOut{})
+		}
+	}
+	return nil
+}
+func (a *Auth) ApplyEvent(ctx context.Context, event interface{}) error {
+	switch e := event.(type) {
+	case *LoggedIn:
+		a.Username = e.Username
+		a.LoggedIn = true
+	case *LoggedOut:
+		a.LoggedIn = false
+	}
+	return nil
+}
+
+// Login is a command
+type Login struct {
+	es.BaseCommand
+
+	Username string
+}
+
+// Logout is a command too
+type Logout struct {
+	es.BaseCommand
+}
+
+// LogoutSaga logs out every user that logs in
+type LogoutSaga struct{}
+
+func (s *LogoutSaga) Run(ctx context.Context, evt *es.Event) ([]es.Command, error) {
+	if _, ok := evt.Data.(*LoggedIn); !ok {
+		return nil, fmt.Errorf("Unexpected event %s", evt.Type)
+	}
+	return []es.Command{
+		&Logout{es.BaseCommand{AggregateID: evt.AggregateID}},
+	}, nil
+}
+
+// recorder is a T that keeps failures so we can test failing scenarios
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAggregate(t *testing.T) {
+	Aggregate(t, &Auth{}).
+		When(&Login{Username: "demouser"}).
+		Then(&LoggedIn{Username: "demouser"})
+
+	Aggregate(t, &Auth{}).
+		Given(&LoggedIn{Username: "demouser"}).
+		When(&Login{Username: "demouser"}).
+		ThenError(ErrAlreadyLoggedIn)
+
+	Aggregate(t, &Auth{}).
+		When(&Logout{}).
+		Then()
+
+	Aggregate(t, &Auth{}).
+		Given(&LoggedIn{Username: "demouser"}, &es.Tombstone{}).
+		When(&Login{Username: "demouser"}).
+		ThenError(es.ErrAggregateDeleted)
+}
+
+func TestAggregateFailures(t *testing.T) {
+	r := &recorder{}
+	Aggregate(r, &Auth{}).
+		When(&Login{Username: "demouser"}).
+		Then(&LoggedIn{Username: "other"})
+	if len(r.errors) != 1 {
+		t.Errorf("Expected a mismatch, got %v", r.errors)
+	}
+
+	r = &recorder{}
+	Aggregate(r, &Auth{}).
+		When(&Login{Username: "demouser"}).
+		ThenError(ErrAlreadyLoggedIn)
+	if len(r.errors) != 1 {
+		t.Errorf("Expected a missing error, got %v", r.errors)
+	}
+
+	r = &recorder{}
+	Aggregate(r, &Auth{}).Then()
+	if len(r.errors) != 1 {
+		t.Errorf("Expected a missing command, got %v", r.errors)
+	}
+}
+
+func TestSaga(t *testing.T) {
+	evt := es.NewEvent(&LoggedIn{Username: "demouser"})
+	evt.AggregateID = "132"
+
+	Saga(t, &LogoutSaga{}).
+		Given(evt).
+		Then(&Logout{es.BaseCommand{AggregateID: "132"}})
+
+	Saga(t, &LogoutSaga{}).
+		Given(&LoggedOut{}).
+		ThenError(nil)
+
+	r := &recorder{}
+	Saga(r, &LogoutSaga{}).
+		Given(evt).
+		Then()
+	if len(r.errors) != 1 {
+		t.Errorf("Expected a mismatch, got %v", r.errors)
+	}
+}
@@ -17,6 +17,7 @@ type Event struct {
 	Version       int         `json:"version"`
 	Data          interface{} `json:"data"`
 	Metadata      Metadata    `json:"metadata"`
+	Tenant        string      `json:"tenant,omitempty"`
 }
 
 // String implements the String method of the Event interface.
@@ -24,7 +25,8 @@ func (e Event) String() string {
 	return fmt.Sprintf("%s@%d", e.Type, e.Version)
 }
 
-// NewEvent will create an event from data
+// NewEvent will create an event from data, the handler and AggregateStore
+// stamp it again with the clock of the context when it's saved
 func NewEvent(data interface{}) *Event {
 	timestamp := GetTimestamp()
 	_, typeName := GetTypeName(data)
@@ -2,6 +2,7 @@ package es
 
 import (
 	"context"
+	"time"
 )
 
 // EventBus for creating commands
@@ -33,6 +34,10 @@ func (b *eventBus) AddPublisher(publisher EventPublisher) {
 }
 
 func (b *eventBus) HandleEvent(ctx context.Context, evt *Event) error {
+	if len(evt.Tenant) == 0 {
+		evt.Tenant = TenantFromContext(ctx)
+	}
+
 	if err := b.handler.HandleEvent(ctx, evt); err != nil {
 		return err
 	}
@@ -42,13 +47,27 @@ func (b *eventBus) HandleEvent(ctx context.Context, evt *Event) error {
 		return nil
 	}
 
-	for _, p := range b.publishers {
-		if err := p.PublishEvent(ctx, evt); err != nil {
-			return err
-		}
+	if len(b.publishers) == 0 {
+		return nil
 	}
 
-	return nil
+	// events that didn't come from an aggregate handler carry the current trace
+	if len(MetadataCarrier(evt).Get("traceparent")) == 0 {
+		InjectTrace(ctx, MetadataCarrier(evt))
+	}
+
+	metrics := MetricsFromContext(ctx)
+	return traced(ctx, "es.PublishEvent "+evt.Type, func(ctx context.Context) error {
+		for _, p := range b.publishers {
+			start := time.Now()
+			err := p.PublishEvent(ctx, evt)
+			metrics.eventPublished(p, evt, start, err)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // Close underlying connection
@@ -0,0 +1,103 @@
+package es
+
+import (
+	"context"
+)
+
+// EventStream iterates over the events of a stream without loading them all
+// at once, call Next before every Event and Close when done
+type EventStream interface {
+	// Next moves to the next event, false when there are no more or on error
+	Next(context.Context) bool
+	// Event returns the current event
+	Event() *Event
+	// Err returns the error that stopped the stream
+	Err() error
+	// Close releases the stream
+	Close(context.Context) error
+}
+
+// EventStreamStore is implemented by datastores that can stream events, so
+// long streams are never held in memory
+type EventStreamStore interface {
+	// LoadEventStream returns the events of a stream after a version
+	LoadEventStream(ctx context.Context, id string, typeName string, fromVersion int) (EventStream, error)
+}
+
+// LoadEventStream streams the events of a stream from the datastore, those
+// that can't stream load them all with LoadEvents
+func LoadEventStream(ctx context.Context, dataStore DataStore, id string, typeName string, fromVersion int) (EventStream, error) {
+	if store, ok := AsStore[EventStreamStore](dataStore); ok {
+		return store.LoadEventStream(ctx, id, typeName, fromVersion)
+	}
+
+	events, err := dataStore.LoadEvents(ctx, id, typeName, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+	return NewEventStream(events), nil
+}
+
+// NewEventStream iterates over events already loaded
+func NewEventStream(events []*Event) EventStream {
+	return &sliceStream{events: events, index: -1}
+}
+
+type sliceStream struct {
+	events []*Event
+	index  int
+}
+
+func (s *sliceStream) Next(context.Context) bool {
+	if s.index+1 >= len(s.events) {
+		return false
+	}
+	s.index++
+	return true
+}
+func (s *sliceStream) Event() *Event {
+	return s.events[s.index]
+}
+func (s *sliceStream) Err() error {
+	return nil
+}
+func (s *sliceStream) Close(context.Context) error {
+	return nil
+}
+
+// CollectEvents reads what's left of the stream and closes it
+func CollectEvents(ctx context.Context, stream EventStream) ([]*Event, error) {
+	defer stream.Close(ctx)
+
+	events := []*Event{}
+	for stream.Next(ctx) {
+		events = append(events, stream.Event())
+	}
+	return events, stream.Err()
+}
+
+// mapStream changes every event of a stream as it's read
+type mapStream struct {
+	EventStream
+
+	fn    func(*Event) (*Event, error)
+	event *Event
+	err   error
+}
+
+func (s *mapStream) Next(ctx context.Context) bool {
+	if s.err != nil || !s.EventStream.Next(ctx) {
+		return false
+	}
+	s.event, s.err = s.fn(s.EventStream.Event())
+	return s.err == nil
+}
+func (s *mapStream) Event() *Event {
+	return s.event
+}
+func (s *mapStream) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.EventStream.Err()
+}
@@ -0,0 +1,96 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// StreamingDataStore only hands out events through a stream
+type StreamingDataStore struct {
+	TestDataStore
+
+	events []*Event
+	closed bool
+}
+
+func (d *StreamingDataStore) LoadEvents(context.Context, string, string, int) ([]*Event, error) {
+	return nil, errors.New("LoadEvents should not be called")
+}
+
+func (d *StreamingDataStore) LoadEventStream(ctx context.Context, id string, typeName string, fromVersion int) (EventStream, error) {
+	return &closeStream{NewEventStream(d.events), d}, nil
+}
+
+type closeStream struct {
+	EventStream
+
+	store *StreamingDataStore
+}
+
+func (s *closeStream) Close(ctx context.Context) error {
+	s.store.closed = true
+	return s.EventStream.Close(ctx)
+}
+
+func TestAggregateHandlerStreamsEvents(t *testing.T) {
+	store := &StreamingDataStore{}
+	for v := 1; v <= 3; v++ {
+		e := NewEvent(&EventTested{"tick"})
+		e.AggregateID = "1"
+		e.AggregateType = "ClockAggregate"
+		e.Version = v
+		store.events = append(store.events, e)
+	}
+
+	var info SnapshotInfo
+	snapshot := &recordingSnapshot{fn: func(i SnapshotInfo) { info = i }}
+	factory := NewAggregateSourcedFactory(NewAggregateSourcedFunc(&ClockAggregate{}))
+	handler := NewAggregateHandler(factory, store, &TestBus{}, "", snapshot, false)
+
+	ctx, result := WithCommandResult(context.Background())
+	if err := handler.HandleCommand(ctx, &ReplayCommand{BaseCommand{AggregateID: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Version != 3 {
+		t.Errorf("got version %d, want 3", result.Version)
+	}
+	if !store.closed {
+		t.Error("stream was not closed")
+	}
+	if info.ReplayedCount != 3 || info.FirstReplayed != store.events[0] {
+		t.Errorf("got %d replayed from %v", info.ReplayedCount, info.FirstReplayed)
+	}
+}
+
+func TestCollectEvents(t *testing.T) {
+	ctx := context.Background()
+	events := []*Event{NewEvent(&EventTested{}), NewEvent(&EventTested{})}
+
+	boom := errors.New("boom")
+	calls := 0
+	stream := &mapStream{EventStream: NewEventStream(events), fn: func(e *Event) (*Event, error) {
+		if calls++; calls > 1 {
+			return nil, boom
+		}
+		return e, nil
+	}}
+
+	got, err := CollectEvents(ctx, stream)
+	if !errors.Is(err, boom) || len(got) != 1 {
+		t.Errorf("got %d events and %v", len(got), err)
+	}
+}
+
+type recordingSnapshot struct {
+	fn func(SnapshotInfo)
+}
+
+func (s *recordingSnapshot) ShouldLoad() bool {
+	return false
+}
+func (s *recordingSnapshot) ShouldSave(info SnapshotInfo) bool {
+	s.fn(info)
+	return false
+}
@@ -0,0 +1,215 @@
+package es
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// importBatchSize is the max number of events saved at once when importing
+const importBatchSize = 500
+
+// ErrVersionGap when imported events don't continue the stored stream
+var ErrVersionGap = errors.New("Event versions are not continuous")
+
+// ErrTenantMismatch when imported events belong to another tenant than ctx
+var ErrTenantMismatch = errors.New("Event belongs to another tenant")
+
+// exportedEvent is how an event is decoded before its payload type is known
+type exportedEvent struct {
+	Type          string          `json:"type"`
+	Timestamp     time.Time       `json:"timestamp"`
+	AggregateID   string          `json:"aggregate_id"`
+	AggregateType string          `json:"aggregate_type"`
+	Version       int             `json:"version"`
+	Tenant        string          `json:"tenant"`
+	Data          json.RawMessage `json:"data"`
+	Metadata      Metadata        `json:"metadata"`
+}
+
+// ExportStream writes the events of a single stream as newline-delimited JSON
+func ExportStream(ctx context.Context, dataStore DataStore, w io.Writer, aggregateType, id string) (int, error) {
+	stream, err := LoadEventStream(ctx, dataStore, id, aggregateType, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close(ctx)
+
+	enc := json.NewEncoder(w)
+	n := 0
+	for stream.Next(ctx) {
+		if err := enc.Encode(stream.Event()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, stream.Err()
+}
+
+// Export writes the events of every stream of the aggregate types as
+// newline-delimited JSON, all the streams are exported when no type is given
+func Export(ctx context.Context, dataStore DataStore, w io.Writer, aggregateTypes ...string) (int, error) {
+	streams, ok := AsStore[StreamStore](dataStore)
+	if !ok {
+		return 0, ErrStreamStoreNotSupported
+	}
+
+	if len(aggregateTypes) == 0 {
+		var err error
+		if aggregateTypes, err = streams.AggregateTypes(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	total := 0
+	for _, aggregateType := range aggregateTypes {
+		ids, err := streams.AggregateIDs(ctx, aggregateType)
+		if err != nil {
+			return total, err
+		}
+
+		for _, id := range ids {
+			n, err := ExportStream(ctx, dataStore, w, aggregateType, id)
+			total = total + n
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+// Import reads newline-delimited JSON events and saves them in the datastore
+// keeping their versions. Every stream has to continue where the stored one
+// ends, and then where the previous line of the same stream left it. The
+// events are imported for the tenant of ctx and have to be exported from it.
+func Import(ctx context.Context, dataStore DataStore, r io.Reader, factory EventDataFactory) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	// the last version imported per stream, the store isn't read back so
+	// dry-runs that never save work too
+	imported := make(map[string]int)
+
+	total := 0
+	line := 0
+	batchLine := 0
+	var batch []*Event
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := dataStore.SaveEvents(ctx, batch, batch[0].Version-1); err != nil {
+			return fmt.Errorf("line %d: %w", batchLine, err)
+		}
+		total = total + len(batch)
+		batch = nil
+		return nil
+	}
+
+	for scanner.Scan() {
+		line = line + 1
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var item exportedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			return total, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if tenant := TenantFromContext(ctx); item.Tenant != tenant {
+			return total, fmt.Errorf("line %d: %s@%d of tenant %q: %w", line, item.AggregateID, item.Version, item.Tenant, ErrTenantMismatch)
+		}
+
+		data, err := factory(item.Type)
+		if err != nil {
+			return total, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(item.Data) > 0 && string(item.Data) != "null" {
+			if err := json.Unmarshal(item.Data, data); err != nil {
+				return total, fmt.Errorf("line %d: %w", line, err)
+			}
+		} else {
+			data = nil
+		}
+
+		event := &Event{
+			Type:          item.Type,
+			Timestamp:     item.Timestamp,
+			AggregateID:   item.AggregateID,
+			AggregateType: item.AggregateType,
+			Version:       item.Version,
+			Tenant:        item.Tenant,
+			Data:          data,
+			Metadata:      item.Metadata,
+		}
+
+		stream := event.AggregateType + "." + event.AggregateID
+		if last, ok := imported[stream]; ok {
+			if last+1 != event.Version {
+				return total, fmt.Errorf("line %d: %s@%d after version %d: %w", line, event.AggregateID, event.Version, last, ErrVersionGap)
+			}
+		} else if err := checkContinuity(ctx, dataStore, event); err != nil {
+			return total, fmt.Errorf("line %d: %w", line, err)
+		}
+		imported[stream] = event.Version
+
+		if len(batch) > 0 {
+			last := batch[len(batch)-1]
+			sameStream := last.AggregateID == event.AggregateID && last.AggregateType == event.AggregateType
+			if !sameStream || len(batch) >= importBatchSize {
+				if err := flush(); err != nil {
+					return total, err
+				}
+			}
+		}
+
+		if len(batch) == 0 {
+			batchLine = line
+		}
+		batch = append(batch, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return total, err
+	}
+
+	if err := flush(); err != nil {
+		return total, err
+	}
+	return total, nil
+}
+
+// checkContinuity ensures the event is the next one of the stored stream
+func checkContinuity(ctx context.Context, dataStore DataStore, event *Event) error {
+	if event.Version < 1 {
+		return fmt.Errorf("%s@%d: %w", event.AggregateID, event.Version, ErrVersionGap)
+	}
+
+	// nothing may be stored at or after the event
+	existing, err := dataStore.LoadEvents(ctx, event.AggregateID, event.AggregateType, event.Version-1)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("%s@%d already stored: %w", event.AggregateID, event.Version, ErrVersionGap)
+	}
+	if event.Version == 1 {
+		return nil
+	}
+
+	// and the previous version has to be
+	previous, err := dataStore.LoadEvents(ctx, event.AggregateID, event.AggregateType, event.Version-2)
+	if err != nil {
+		return err
+	}
+	if len(previous) != 1 {
+		return fmt.Errorf("%s@%d is missing version %d: %w", event.AggregateID, event.Version, event.Version-1, ErrVersionGap)
+	}
+	return nil
+}
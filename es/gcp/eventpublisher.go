@@ -4,98 +4,229 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"sync"
 
 	"cloud.google.com/go/pubsub"
-	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/api/option"
 
 	"github.com/contextgg/go-es/es"
 )
 
+const (
+	// AttributeEventType is the message attribute holding the event type
+	AttributeEventType = "event_type"
+	// AttributeAggregateType is the message attribute holding the aggregate type
+	AttributeAggregateType = "aggregate_type"
+	// AttributeAggregateID is the message attribute holding the aggregate id
+	AttributeAggregateID = "aggregate_id"
+	// AttributeVersion is the message attribute holding the event version
+	AttributeVersion = "version"
+	// AttributeTenant is the message attribute holding the tenant, if any
+	AttributeTenant = "tenant"
+)
+
+// Option so we can configure the client
+type Option = func(*Client)
+
+// ClientOptions passes options down to the underlying pubsub client,
+// useful for pointing at an emulator or the pstest fake server
+func ClientOptions(opts ...option.ClientOption) Option {
+	return func(c *Client) {
+		c.clientOpts = append(c.clientOpts, opts...)
+	}
+}
+
+// OrderByAggregate sets the ordering key of every message to its aggregate,
+// see OrderingKey, so subscribers receive an aggregate's events in order. A
+// failed publish pauses the key and the later events of the aggregate fail
+// too, until ResumePublish is called once the failed event was dealt with.
+func OrderByAggregate() Option {
+	return func(c *Client) {
+		c.ordered = true
+	}
+}
+
+// PublishAsync returns as soon as the event is queued, the publish results
+// are checked in the background and flushed on Close. Failures are logged
+// and passed to OnPublishError.
+func PublishAsync() Option {
+	return func(c *Client) {
+		c.async = true
+	}
+}
+
+// PublishSettings sets how messages are batched before being sent
+func PublishSettings(settings pubsub.PublishSettings) Option {
+	return func(c *Client) {
+		c.settings = &settings
+	}
+}
+
+// OnPublishError is called with every event an async publish failed to send
+func OnPublishError(fn func(*es.Event, error)) Option {
+	return func(c *Client) {
+		c.onError = fn
+	}
+}
+
+// WithLogger sets the logger used when the context has none
+func WithLogger(logger es.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
 // Client nats
 type Client struct {
 	client *pubsub.Client
 	topic  *pubsub.Topic
+
+	clientOpts []option.ClientOption
+	settings   *pubsub.PublishSettings
+	ordered    bool
+	async      bool
+	pending    sync.WaitGroup
+	logger     es.Logger
+	onError    func(*es.Event, error)
 }
 
 // NewClient returns the basic client to access to nats
-func NewClient(projectID string, topicName string) (es.EventPublisher, error) {
+func NewClient(projectID string, topicName string, opts ...Option) (es.EventPublisher, error) {
+	c := &Client{
+		logger: es.DefaultLogger(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
 
 	// TODO: maybe we look into subscribing for events?
 	ctx := context.Background()
-	cli, err := pubsub.NewClient(ctx, projectID)
+	cli, err := pubsub.NewClient(ctx, projectID, c.clientOpts...)
 	if err != nil {
-		log.
-			Error().
-			Err(err).
-			Str("projectID", projectID).
-			Str("topicName", topicName).
-			Msg("pubsub.NewClient")
+		c.logger.Error("pubsub.NewClient",
+			"error", err,
+			"projectID", projectID,
+			"topicName", topicName,
+		)
 		return nil, fmt.Errorf("pubsub.NewClient: %v", err)
 	}
 
 	topic := cli.Topic(topicName)
 	if ok, err := topic.Exists(ctx); err != nil {
-		log.
-			Error().
-			Err(err).
-			Msg("topic.Exists")
+		c.logger.Error("topic.Exists", "error", err)
 		return nil, err
 	} else if !ok {
 		if topic, err = cli.CreateTopic(ctx, topicName); err != nil {
-			log.
-				Error().
-				Err(err).
-				Str("topicName", topicName).
-				Msg("cli.CreateTopic")
+			c.logger.Error("cli.CreateTopic",
+				"error", err,
+				"topicName", topicName,
+			)
 			return nil, err
 		}
 	}
 
-	return &Client{
-		client: cli,
-		topic:  topic,
-	}, nil
+	if c.settings != nil {
+		topic.PublishSettings = *c.settings
+	}
+	topic.EnableMessageOrdering = c.ordered
+
+	c.client = cli
+	c.topic = topic
+	return c, nil
 }
 
-// PublishEvent via nats
+// PublishEvent via pubsub
 func (c *Client) PublishEvent(ctx context.Context, event *es.Event) error {
+	logger := es.LoggerFromContext(ctx, c.logger)
+
 	msg, err := json.Marshal(event)
 	if err != nil {
-		log.
-			Error().
-			Err(err).
-			Msg("json.Marshal")
+		logger.Error("json.Marshal", "error", err)
 		return err
 	}
 
-	publishCtx := context.Background()
-	res := c.topic.Publish(publishCtx, &pubsub.Message{
+	m := &pubsub.Message{
 		Data: msg,
-	})
-	if _, err := res.Get(publishCtx); err != nil {
-		log.
-			Error().
-			Err(err).
-			Msg("Could not publish event")
+		Attributes: map[string]string{
+			AttributeEventType:     event.Type,
+			AttributeAggregateType: event.AggregateType,
+			AttributeAggregateID:   event.AggregateID,
+			AttributeVersion:       strconv.Itoa(event.Version),
+		},
+	}
+	if len(event.Tenant) > 0 {
+		m.Attributes[AttributeTenant] = event.Tenant
+	}
+	if c.ordered {
+		m.OrderingKey = OrderingKey(event)
+	}
+	es.InjectTrace(ctx, propagation.MapCarrier(m.Attributes))
+
+	if c.async {
+		// the message outlives the request, so does what publishes it
+		res := c.topic.Publish(context.Background(), m)
+		c.pending.Add(1)
+		go func() {
+			defer c.pending.Done()
+			if err := c.wait(context.Background(), logger, res, event); err != nil && c.onError != nil {
+				c.onError(event, err)
+			}
+		}()
+		return nil
+	}
+
+	res := c.topic.Publish(ctx, m)
+
+	return c.wait(ctx, logger, res, event)
+}
+
+func (c *Client) wait(ctx context.Context, logger es.Logger, res *pubsub.PublishResult, event *es.Event) error {
+	if _, err := res.Get(ctx); err != nil {
+		logger.Error("Could not publish event",
+			"error", err,
+			"event_type", event.Type,
+			"event_aggregate_id", event.AggregateID,
+		)
 		return err
 	}
 
-	log.
-		Debug().
-		Str("topic_id", c.topic.ID()).
-		Str("event_type", event.Type).
-		Str("event_aggregate_id", event.AggregateID).
-		Str("event_aggregate_type", event.AggregateType).
-		Msg("Event Published via GCP pub/sub")
+	logger.Debug("Event Published via GCP pub/sub",
+		"topic_id", c.topic.ID(),
+		"event_type", event.Type,
+		"event_aggregate_id", event.AggregateID,
+		"event_aggregate_type", event.AggregateType,
+	)
 	return nil
 }
 
-// Close underlying connection
+// ResumePublish lets the events of the aggregate be published again after a
+// failed publish paused them, resuming before the failed event was published
+// again gives up on their order
+func (c *Client) ResumePublish(event *es.Event) {
+	if c.ordered {
+		c.topic.ResumePublish(OrderingKey(event))
+	}
+}
+
+// OrderingKey returns the ordering key of the events of an aggregate
+func OrderingKey(event *es.Event) string {
+	key := event.AggregateType + "/" + event.AggregateID
+	if len(event.Tenant) > 0 {
+		key = event.Tenant + "/" + key
+	}
+	return key
+}
+
+// Close flushes any pending messages and closes the underlying connection
 func (c *Client) Close() {
+	if c.topic != nil {
+		c.topic.Stop()
+		c.pending.Wait()
+	}
 	if c.client != nil {
-		log.
-			Debug().
-			Msg("Closing the pubsub connection")
+		c.logger.Debug("Closing the pubsub connection")
 		c.client.Close()
 	}
 }
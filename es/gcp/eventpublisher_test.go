@@ -0,0 +1,165 @@
+package gcp
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+
+	"github.com/contextgg/go-es/es"
+)
+
+// LoggedIn for testing
+type LoggedIn struct {
+	Username string
+}
+
+func newTestClient(t *testing.T, opts ...Option) (*Client, *pstest.Server) {
+	srv := pstest.NewServer()
+	conn, err := grpc.Dial(srv.Addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts = append(opts, ClientOptions(option.WithGRPCConn(conn)))
+	publisher, err := NewClient("project", "events", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return publisher.(*Client), srv
+}
+
+func newEvent(id string, version int) *es.Event {
+	evt := es.NewEvent(&LoggedIn{"demouser"})
+	evt.AggregateID = id
+	evt.AggregateType = "Auth"
+	evt.Version = version
+	return evt
+}
+
+func TestPublishAttributes(t *testing.T) {
+	client, srv := newTestClient(t, OrderByAggregate())
+	defer srv.Close()
+	defer client.Close()
+
+	if err := client.PublishEvent(context.Background(), newEvent("132", 3)); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := srv.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+
+	want := map[string]string{
+		AttributeEventType:     "LoggedIn",
+		AttributeAggregateType: "Auth",
+		AttributeAggregateID:   "132",
+		AttributeVersion:       "3",
+	}
+	for k, v := range want {
+		if msgs[0].Attributes[k] != v {
+			t.Errorf("attribute %s: got %q, want %q", k, msgs[0].Attributes[k], v)
+		}
+	}
+	if msgs[0].OrderingKey != "Auth/132" {
+		t.Errorf("ordering key: got %q, want %q", msgs[0].OrderingKey, "Auth/132")
+	}
+}
+
+func TestOrderingKey(t *testing.T) {
+	evt := newEvent("132", 1)
+	if got := OrderingKey(evt); got != "Auth/132" {
+		t.Errorf("got %q, want %q", got, "Auth/132")
+	}
+	evt.Tenant = "acme"
+	if got := OrderingKey(evt); got != "acme/Auth/132" {
+		t.Errorf("got %q, want %q", got, "acme/Auth/132")
+	}
+}
+
+func TestPublishPausesAggregate(t *testing.T) {
+	client, srv := newTestClient(t, OrderByAggregate(), PublishSettings(pubsub.PublishSettings{
+		BufferedByteLimit: 1024,
+	}))
+	defer srv.Close()
+	defer client.Close()
+
+	// too large to be buffered
+	big := newEvent("132", 1)
+	big.Data = &LoggedIn{strings.Repeat("x", 2048)}
+	if err := client.PublishEvent(context.Background(), big); err == nil {
+		t.Fatal("expected the publish to fail")
+	}
+
+	// the events after it wait for the aggregate to be resumed
+	if err := client.PublishEvent(context.Background(), newEvent("132", 2)); err == nil {
+		t.Error("expected the aggregate to be paused")
+	}
+	if err := client.PublishEvent(context.Background(), newEvent("133", 1)); err != nil {
+		t.Errorf("other aggregates are not paused: %v", err)
+	}
+
+	client.ResumePublish(big)
+	if err := client.PublishEvent(context.Background(), newEvent("132", 2)); err != nil {
+		t.Errorf("got %v after resuming", err)
+	}
+}
+
+func TestPublishAsyncFlushesOnClose(t *testing.T) {
+	client, srv := newTestClient(t, PublishAsync(), PublishSettings(pubsub.PublishSettings{
+		CountThreshold: 10,
+		DelayThreshold: time.Hour,
+	}))
+	defer srv.Close()
+
+	for i := 1; i <= 3; i++ {
+		if err := client.PublishEvent(context.Background(), newEvent("132", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client.Close()
+
+	if n := len(srv.Messages()); n != 3 {
+		t.Errorf("got %d messages, want 3", n)
+	}
+}
+
+func TestPublishAsyncErrors(t *testing.T) {
+	var mu sync.Mutex
+	var failed []*es.Event
+	client, srv := newTestClient(t, PublishAsync(), OnPublishError(func(event *es.Event, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, event)
+	}))
+	defer srv.Close()
+
+	// a cancelled request doesn't stop what was already queued
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := client.PublishEvent(ctx, newEvent("132", 1)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	// a stopped topic fails every later publish
+	client.topic.Stop()
+	evt := newEvent("132", 2)
+	if err := client.PublishEvent(context.Background(), evt); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if n := len(srv.Messages()); n != 1 {
+		t.Errorf("got %d messages, want 1", n)
+	}
+	if len(failed) != 1 || failed[0] != evt {
+		t.Errorf("got failed events %v", failed)
+	}
+}
@@ -0,0 +1,137 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/contextgg/go-es/es"
+)
+
+// Client sends commands to a remote gateway, it's an es.CommandHandler so
+// remote aggregates can be wired with builder.WireCommandHandler
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// NewClient creates a client on an existing connection
+func NewClient(conn *grpc.ClientConn) *Client {
+	return &Client{conn}
+}
+
+// HandleCommand dispatches the command to the remote command bus
+func (c *Client) HandleCommand(ctx context.Context, cmd es.Command) error {
+	_, name := es.GetTypeName(cmd)
+	payload, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	req := &CommandRequest{
+		Name:        name,
+		AggregateID: cmd.GetAggregateID(),
+		Payload:     payload,
+	}
+	reply := &CommandReply{}
+	if err := c.conn.Invoke(withTenant(ctx), dispatchMethod, req, reply, grpc.CallContentSubtype(CodecName)); err != nil {
+		return fromStatus(err)
+	}
+	return nil
+}
+
+// SubscribeEvents streams the remote events of the given types, or all of
+// them, to the handler until ctx is done or the stream fails. Only the
+// events of the tenant of ctx are streamed. The payloads
+// are decoded into the types from factory, a nil factory or an unknown type
+// leaves them as json.RawMessage.
+func (c *Client) SubscribeEvents(ctx context.Context, handler es.EventHandler, factory es.EventDataFactory, types ...string) error {
+	desc := &grpc.StreamDesc{
+		StreamName:    "SubscribeEvents",
+		ServerStreams: true,
+	}
+	stream, err := c.conn.NewStream(withTenant(ctx), desc, subscribeEventsMethod, grpc.CallContentSubtype(CodecName))
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(&SubscribeRequest{Types: types}); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		msg := &EventMessage{}
+		if err := stream.RecvMsg(msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		event, err := toEvent(msg, factory)
+		if err != nil {
+			return err
+		}
+		if err := handler.HandleEvent(ctx, event); err != nil {
+			return err
+		}
+	}
+}
+
+// withTenant sends the tenant of ctx to the server
+func withTenant(ctx context.Context) context.Context {
+	if tenant := es.TenantFromContext(ctx); len(tenant) > 0 {
+		return metadata.AppendToOutgoingContext(ctx, TenantMetadata, tenant)
+	}
+	return ctx
+}
+
+func toEvent(msg *EventMessage, factory es.EventDataFactory) (*es.Event, error) {
+	var data interface{} = msg.Data
+	if factory != nil {
+		if d, err := factory(msg.Type); err == nil {
+			if err := json.Unmarshal(msg.Data, d); err != nil {
+				return nil, err
+			}
+			data = d
+		}
+	}
+
+	return &es.Event{
+		Type:          msg.Type,
+		Timestamp:     msg.Timestamp,
+		AggregateID:   msg.AggregateID,
+		AggregateType: msg.AggregateType,
+		Version:       msg.Version,
+		Data:          data,
+		Metadata:      msg.Metadata,
+		Tenant:        msg.Tenant,
+	}, nil
+}
+
+// fromStatus turns the codes set by the server back into es errors
+func fromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.Unimplemented:
+		return fmt.Errorf("%w: %s", es.ErrCommandNotFound, st.Message())
+	case codes.Aborted:
+		return fmt.Errorf("%w: %s", es.ErrVersionMismatch, st.Message())
+	case codes.AlreadyExists:
+		return fmt.Errorf("%w: %s", es.ErrAggregateExists, st.Message())
+	case codes.NotFound:
+		return fmt.Errorf("%w: %s", es.ErrAggregateNotFound, st.Message())
+	case codes.FailedPrecondition:
+		return fmt.Errorf("%w: %s", es.ErrAggregateDeleted, st.Message())
+	}
+	return err
+}
@@ -0,0 +1,267 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/contextgg/go-es/es"
+)
+
+type TryLoginCommand struct {
+	es.BaseCommand
+
+	Username string `json:"username"`
+}
+
+type LoggedIn struct {
+	Username string `json:"username"`
+}
+
+type LoggedOut struct{}
+
+func newClient(t *testing.T, fn func(context.Context, es.Command) error, opts ...Option) (*Client, *Server) {
+	bus := es.NewCommandBus()
+	if err := bus.SetHandler(es.CommandHandlerFunc(fn), &TryLoginCommand{}); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(bus, opts...)
+	srv := grpc.NewServer()
+	server.Register(srv)
+
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+
+	dialer := func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}
+	conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		server.Close()
+		srv.Stop()
+	})
+	return NewClient(conn), server
+}
+
+func TestDispatch(t *testing.T) {
+	var got *TryLoginCommand
+	client, _ := newClient(t, func(ctx context.Context, cmd es.Command) error {
+		got = cmd.(*TryLoginCommand)
+		return nil
+	})
+
+	cmd := &TryLoginCommand{
+		BaseCommand: es.BaseCommand{AggregateID: "42"},
+		Username:    "bob",
+	}
+	if err := client.HandleCommand(context.Background(), cmd); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.AggregateID != "42" || got.Username != "bob" {
+		t.Errorf("got command %+v", got)
+	}
+}
+
+func TestDispatchErrors(t *testing.T) {
+	data := []struct {
+		name string
+		cmd  es.Command
+		err  error
+		is   error
+	}{
+		{"unknown command", &es.ReplayCommand{BaseCommand: es.BaseCommand{AggregateID: "1"}}, nil, es.ErrCommandNotFound},
+		{"version conflict", &TryLoginCommand{BaseCommand: es.BaseCommand{AggregateID: "1"}}, es.ErrVersionMismatch, es.ErrVersionMismatch},
+		{"already exists", &TryLoginCommand{BaseCommand: es.BaseCommand{AggregateID: "1"}}, es.ErrAggregateExists, es.ErrAggregateExists},
+		{"not found", &TryLoginCommand{BaseCommand: es.BaseCommand{AggregateID: "1"}}, es.ErrAggregateNotFound, es.ErrAggregateNotFound},
+		{"deleted", &TryLoginCommand{BaseCommand: es.BaseCommand{AggregateID: "1"}}, es.ErrAggregateDeleted, es.ErrAggregateDeleted},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			client, _ := newClient(t, func(ctx context.Context, cmd es.Command) error {
+				return d.err
+			})
+
+			err := client.HandleCommand(context.Background(), d.cmd)
+			if !errors.Is(err, d.is) {
+				t.Errorf("expected %v, got %v", d.is, err)
+			}
+		})
+	}
+}
+
+func TestSubscribeEvents(t *testing.T) {
+	client, server := newClient(t, func(ctx context.Context, cmd es.Command) error {
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	factory := func(name string) (interface{}, error) {
+		if name == "LoggedIn" {
+			return &LoggedIn{}, nil
+		}
+		return nil, errors.New("unknown event")
+	}
+
+	events := make(chan *es.Event, 1)
+	handler := es.EventHandlerFunc(func(ctx context.Context, event *es.Event) error {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+	go client.SubscribeEvents(ctx, handler, factory, "LoggedIn")
+
+	// keep publishing until the subscription is in place
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			t.Fatal("no event received")
+		case <-ticker.C:
+			server.PublishEvent(ctx, &es.Event{Type: "LoggedOut", AggregateID: "1", Data: &LoggedOut{}})
+			server.PublishEvent(ctx, &es.Event{Type: "LoggedIn", AggregateID: "1", Data: &LoggedIn{Username: "bob"}})
+		case event := <-events:
+			if event.Type != "LoggedIn" {
+				t.Fatalf("got event %s", event.Type)
+			}
+			if data, ok := event.Data.(*LoggedIn); !ok || data.Username != "bob" {
+				t.Errorf("got data %+v", event.Data)
+			}
+			return
+		}
+	}
+}
+
+func TestDispatchTenant(t *testing.T) {
+	var tenant string
+	client, _ := newClient(t, func(ctx context.Context, cmd es.Command) error {
+		tenant = es.TenantFromContext(ctx)
+		return nil
+	})
+
+	ctx := es.WithTenant(context.Background(), "acme")
+	if err := client.HandleCommand(ctx, &TryLoginCommand{BaseCommand: es.BaseCommand{AggregateID: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if tenant != "acme" {
+		t.Errorf("got tenant %q, want acme", tenant)
+	}
+}
+
+func TestDispatchTenantFrom(t *testing.T) {
+	var tenant string
+	client, server := newClient(t, func(ctx context.Context, cmd es.Command) error {
+		tenant = es.TenantFromContext(ctx)
+		return nil
+	}, TenantFrom(func(context.Context) string {
+		return "globex"
+	}))
+
+	// the tenant the client sends isn't trusted
+	ctx := es.WithTenant(context.Background(), "acme")
+	if err := client.HandleCommand(ctx, &TryLoginCommand{BaseCommand: es.BaseCommand{AggregateID: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if tenant != "globex" {
+		t.Errorf("got tenant %q, want globex", tenant)
+	}
+
+	// the one an interceptor put in the context is kept
+	ctx = es.WithTenant(context.Background(), "initech")
+	if _, err := server.Dispatch(ctx, &CommandRequest{Name: "TryLoginCommand", AggregateID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if tenant != "initech" {
+		t.Errorf("got tenant %q, want initech", tenant)
+	}
+}
+
+func TestSubscribeEventsTenant(t *testing.T) {
+	client, server := newClient(t, func(ctx context.Context, cmd es.Command) error {
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events := make(chan *es.Event, 1)
+	handler := es.EventHandlerFunc(func(ctx context.Context, event *es.Event) error {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+	go client.SubscribeEvents(es.WithTenant(ctx, "acme"), handler, nil)
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			t.Fatal("no event received")
+		case <-ticker.C:
+			server.PublishEvent(ctx, &es.Event{Type: "LoggedIn", AggregateID: "1", Tenant: "globex"})
+			server.PublishEvent(ctx, &es.Event{Type: "LoggedIn", AggregateID: "2"})
+			server.PublishEvent(ctx, &es.Event{Type: "LoggedIn", AggregateID: "3", Tenant: "acme"})
+		case event := <-events:
+			if event.Tenant != "acme" || event.AggregateID != "3" {
+				t.Fatalf("got event %s of tenant %q", event.AggregateID, event.Tenant)
+			}
+			return
+		}
+	}
+}
+
+// errorLogger keeps the errors logged by the server
+type errorLogger struct {
+	es.Logger
+
+	errors []interface{}
+}
+
+func (l *errorLogger) Error(msg string, kv ...interface{}) {
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i] == "error" {
+			l.errors = append(l.errors, kv[i+1])
+		}
+	}
+}
+func (l *errorLogger) With(...interface{}) es.Logger {
+	return l
+}
+
+func TestDispatchHidesInternalErrors(t *testing.T) {
+	logger := &errorLogger{Logger: es.NopLogger()}
+	boom := errors.New("mongo: connection refused to 10.0.0.7")
+	client, _ := newClient(t, func(ctx context.Context, cmd es.Command) error {
+		return boom
+	}, WithLogger(logger))
+
+	err := client.HandleCommand(context.Background(), &TryLoginCommand{BaseCommand: es.BaseCommand{AggregateID: "1"}})
+	if status.Code(err) != codes.Internal || strings.Contains(err.Error(), "mongo") {
+		t.Errorf("got %v", err)
+	}
+	if len(logger.errors) != 1 || logger.errors[0] != boom {
+		t.Errorf("got logged errors %v", logger.errors)
+	}
+}
@@ -0,0 +1,284 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/contextgg/go-es/es"
+)
+
+var (
+	// ErrSlowSubscriber when a subscriber doesn't keep up with the events
+	ErrSlowSubscriber = errors.New("Subscriber is too slow")
+	// ErrServerClosed when the server stops streaming events
+	ErrServerClosed = errors.New("Server closed")
+
+	errMissingID = errors.New("Missing aggregate ID")
+	errInternal  = errors.New("Internal server error")
+)
+
+// TenantMetadata is the metadata key the client sends the tenant with
+const TenantMetadata = "es-tenant"
+
+// Option so we can configure the server
+type Option = func(*Server)
+
+// BufferSize sets how many events a subscriber may fall behind before it's
+// disconnected with ErrSlowSubscriber
+func BufferSize(n int) Option {
+	return func(s *Server) {
+		s.bufferSize = n
+	}
+}
+
+// TenantFrom sets the function reading the tenant of a call, like from the
+// claims an auth interceptor checked, the default trusts the tenant the
+// client sent with TenantFromMetadata. A tenant already in the context is
+// always kept.
+func TenantFrom(fn func(context.Context) string) Option {
+	return func(s *Server) {
+		s.tenantFrom = fn
+	}
+}
+
+// WithLogger sets the logger used when the context has none
+func WithLogger(logger es.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// Server dispatches remote commands through the command bus and streams
+// the published events to subscribers. Register it on a grpc.Server and add
+// it to the event bus as a publisher.
+type Server struct {
+	bus        es.CommandBus
+	bufferSize int
+	tenantFrom func(context.Context) string
+	logger     es.Logger
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	closed      bool
+}
+
+type subscriber struct {
+	tenant string
+	types  map[string]bool
+	events chan *EventMessage
+	done   chan error
+}
+
+// NewServer creates the gateway for the command bus
+func NewServer(bus es.CommandBus, opts ...Option) *Server {
+	s := &Server{
+		bus:         bus,
+		bufferSize:  64,
+		tenantFrom:  TenantFromMetadata,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register the gateway service on a grpc server
+func (s *Server) Register(srv *grpc.Server) {
+	srv.RegisterService(&serviceDesc, s)
+}
+
+// Dispatch decodes the command and handles it through the command bus, as
+// the tenant of the call
+func (s *Server) Dispatch(ctx context.Context, req *CommandRequest) (*CommandReply, error) {
+	if tenant := s.tenant(ctx); len(tenant) > 0 {
+		ctx = es.WithTenant(ctx, tenant)
+	}
+
+	cmd, err := s.bus.NewCommand(req.Name)
+	if err == nil {
+		// replays rebuild state and are for operators, not clients
+		if _, ok := cmd.(*es.ReplayCommand); ok {
+			err = es.ErrCommandNotFound
+		}
+	}
+	if err != nil {
+		return nil, s.toStatus(ctx, err, req.Name, req.AggregateID)
+	}
+
+	if len(req.Payload) > 0 {
+		if err := json.Unmarshal(req.Payload, cmd); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	if len(req.AggregateID) > 0 {
+		if settable, ok := cmd.(es.SettableID); ok {
+			settable.SetID(req.AggregateID)
+		}
+	}
+	if len(cmd.GetAggregateID()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, errMissingID.Error())
+	}
+	if v, ok := cmd.(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	if err := s.bus.HandleCommand(ctx, cmd); err != nil {
+		return nil, s.toStatus(ctx, err, req.Name, cmd.GetAggregateID())
+	}
+
+	return &CommandReply{
+		AggregateID: cmd.GetAggregateID(),
+	}, nil
+}
+
+// SubscribeEvents streams the published events of the tenant of the call
+// until the client goes away
+func (s *Server) SubscribeEvents(req *SubscribeRequest, stream grpc.ServerStream) error {
+	sub := &subscriber{
+		tenant: s.tenant(stream.Context()),
+		events: make(chan *EventMessage, s.bufferSize),
+		done:   make(chan error, 1),
+	}
+	if len(req.Types) > 0 {
+		sub.types = make(map[string]bool, len(req.Types))
+		for _, t := range req.Types {
+			sub.types[t] = true
+		}
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return status.Error(codes.Unavailable, ErrServerClosed.Error())
+	}
+	s.subscribers[sub] = struct{}{}
+	s.mu.Unlock()
+
+	defer s.unsubscribe(sub)
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.done:
+			return err
+		case msg := <-sub.events:
+			if err := stream.SendMsg(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) unsubscribe(sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.subscribers, sub)
+}
+
+// PublishEvent sends the event to every subscriber of its tenant interested
+// in its type
+func (s *Server) PublishEvent(ctx context.Context, event *es.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	msg := &EventMessage{
+		Type:          event.Type,
+		Timestamp:     event.Timestamp,
+		AggregateID:   event.AggregateID,
+		AggregateType: event.AggregateType,
+		Version:       event.Version,
+		Data:          data,
+		Metadata:      event.Metadata,
+		Tenant:        event.Tenant,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sub := range s.subscribers {
+		if sub.tenant != event.Tenant || (sub.types != nil && !sub.types[event.Type]) {
+			continue
+		}
+		select {
+		case sub.events <- msg:
+		default:
+			// never block the command path on a slow subscriber
+			delete(s.subscribers, sub)
+			sub.done <- status.Error(codes.ResourceExhausted, ErrSlowSubscriber.Error())
+		}
+	}
+	return nil
+}
+
+// Close ends every subscription
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for sub := range s.subscribers {
+		delete(s.subscribers, sub)
+		sub.done <- status.Error(codes.Unavailable, ErrServerClosed.Error())
+	}
+}
+
+// tenant returns the tenant of a call
+func (s *Server) tenant(ctx context.Context) string {
+	if tenant := es.TenantFromContext(ctx); len(tenant) > 0 {
+		return tenant
+	}
+	if s.tenantFrom == nil {
+		return ""
+	}
+	return s.tenantFrom(ctx)
+}
+
+// TenantFromMetadata reads the tenant the client sent
+func TenantFromMetadata(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(TenantMetadata); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// toStatus maps the errors clients can act on to gRPC codes, the details of
+// any other error are logged and hidden from the client
+func (s *Server) toStatus(ctx context.Context, err error, name string, id string) error {
+	switch {
+	case errors.Is(err, es.ErrCommandNotFound):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, es.ErrVersionMismatch):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, es.ErrAggregateExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, es.ErrAggregateNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, es.ErrAggregateDeleted):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if st, ok := status.FromError(err); ok && st.Code() != codes.Internal && st.Code() != codes.Unknown {
+		return err
+	}
+
+	es.LoggerFromContext(ctx, s.logger).Error("Could not handle command",
+		"error", err,
+		"command", name,
+		"aggregate_id", id,
+	)
+	return status.Error(codes.Internal, errInternal.Error())
+}
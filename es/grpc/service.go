@@ -0,0 +1,121 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+
+	"github.com/contextgg/go-es/es"
+)
+
+// CodecName is the content-subtype of the messages, they are plain JSON so
+// any gRPC client can talk to the gateway without generated code
+const CodecName = "json"
+
+// ServiceName of the gateway
+const ServiceName = "es.Gateway"
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+func (jsonCodec) Name() string {
+	return CodecName
+}
+
+// CommandRequest asks for the command registered under Name to be handled,
+// Payload is the JSON of the command
+type CommandRequest struct {
+	Name        string          `json:"name"`
+	AggregateID string          `json:"aggregate_id,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+}
+
+// CommandReply is returned once the command was handled
+type CommandReply struct {
+	AggregateID string `json:"aggregate_id"`
+}
+
+// SubscribeRequest filters the events streamed, no types means every event
+type SubscribeRequest struct {
+	Types []string `json:"types,omitempty"`
+}
+
+// EventMessage is an event on the wire, Data is the JSON of the payload
+type EventMessage struct {
+	Type          string          `json:"type"`
+	Timestamp     time.Time       `json:"timestamp"`
+	AggregateID   string          `json:"aggregate_id"`
+	AggregateType string          `json:"aggregate_type"`
+	Version       int             `json:"version"`
+	Data          json.RawMessage `json:"data,omitempty"`
+	Metadata      es.Metadata     `json:"metadata,omitempty"`
+	Tenant        string          `json:"tenant,omitempty"`
+}
+
+// gatewayServer is what the service description dispatches to
+type gatewayServer interface {
+	Dispatch(context.Context, *CommandRequest) (*CommandReply, error)
+	SubscribeEvents(*SubscribeRequest, grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*gatewayServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Dispatch",
+			Handler:    dispatchHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeEvents",
+			Handler:       subscribeEventsHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "es/grpc",
+}
+
+const (
+	dispatchMethod        = "/" + ServiceName + "/Dispatch"
+	subscribeEventsMethod = "/" + ServiceName + "/SubscribeEvents"
+)
+
+func dispatchHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := &CommandRequest{}
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(gatewayServer).Dispatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: dispatchMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(gatewayServer).Dispatch(ctx, req.(*CommandRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func subscribeEventsHandler(srv interface{}, stream grpc.ServerStream) error {
+	in := &SubscribeRequest{}
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return srv.(gatewayServer).SubscribeEvents(in, stream)
+}
@@ -0,0 +1,122 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	// ErrUnhandledCommand when an aggregate has no handler for a command
+	ErrUnhandledCommand = errors.New("Unhandled command")
+	// ErrUnhandledEvent when an aggregate has no applier for an event
+	ErrUnhandledEvent = errors.New("Unhandled event")
+)
+
+// Handlers routes the commands and events of aggregate A to typed functions
+// registered with On and Apply. The table is built once per aggregate type
+// and the aggregate forwards to it:
+//
+//	var authHandlers = es.NewHandlers[*Auth]()
+//
+//	func init() {
+//		es.On(authHandlers, func(ctx context.Context, a *Auth, cmd *Login) error {
+//			a.StoreEvent(&LoggedIn{Username: cmd.Username})
+//			return nil
+//		})
+//		es.Apply(authHandlers, func(a *Auth, e *LoggedIn) {
+//			a.Username = e.Username
+//		})
+//	}
+//
+//	func (a *Auth) HandleCommand(ctx context.Context, cmd es.Command) error {
+//		return authHandlers.HandleCommand(ctx, a, cmd)
+//	}
+//	func (a *Auth) ApplyEvent(ctx context.Context, data interface{}) error {
+//		return authHandlers.ApplyEvent(ctx, a, data)
+//	}
+type Handlers[A AggregateSourced] struct {
+	commands     map[reflect.Type]func(context.Context, A, Command) error
+	commandTypes []reflect.Type
+	events       map[reflect.Type]func(A, interface{})
+	eventTypes   []reflect.Type
+}
+
+// NewHandlers creates an empty table for aggregate A
+func NewHandlers[A AggregateSourced]() *Handlers[A] {
+	return &Handlers[A]{
+		commands: make(map[reflect.Type]func(context.Context, A, Command) error),
+		events:   make(map[reflect.Type]func(A, interface{})),
+	}
+}
+
+// On registers the function handling commands of type C
+func On[A AggregateSourced, C Command](h *Handlers[A], fn func(context.Context, A, C) error) {
+	t := reflect.TypeOf((*C)(nil)).Elem()
+	if _, ok := h.commands[t]; !ok {
+		h.commandTypes = append(h.commandTypes, t)
+	}
+	h.commands[t] = func(ctx context.Context, aggregate A, cmd Command) error {
+		return fn(ctx, aggregate, cmd.(C))
+	}
+}
+
+// Apply registers the function applying events of type E
+func Apply[A AggregateSourced, E any](h *Handlers[A], fn func(A, E)) {
+	t := reflect.TypeOf((*E)(nil)).Elem()
+	if _, ok := h.events[t]; !ok {
+		h.eventTypes = append(h.eventTypes, t)
+	}
+	h.events[t] = func(aggregate A, data interface{}) {
+		fn(aggregate, data.(E))
+	}
+}
+
+// HandleCommand calls the function registered for the type of cmd
+func (h *Handlers[A]) HandleCommand(ctx context.Context, aggregate A, cmd Command) error {
+	fn, ok := h.commands[reflect.TypeOf(cmd)]
+	if !ok {
+		_, name := GetTypeName(cmd)
+		return fmt.Errorf("%w: %s", ErrUnhandledCommand, name)
+	}
+	return fn(ctx, aggregate, cmd)
+}
+
+// ApplyEvent calls the function registered for the type of data
+func (h *Handlers[A]) ApplyEvent(ctx context.Context, aggregate A, data interface{}) error {
+	fn, ok := h.events[reflect.TypeOf(data)]
+	if !ok {
+		_, name := GetTypeName(data)
+		return fmt.Errorf("%w: %s", ErrUnhandledEvent, name)
+	}
+	fn(aggregate, data)
+	return nil
+}
+
+// Commands returns an instance of every command with a handler
+func (h *Handlers[A]) Commands() []Command {
+	commands := make([]Command, 0, len(h.commandTypes))
+	for _, t := range h.commandTypes {
+		commands = append(commands, newInstance(t).(Command))
+	}
+	return commands
+}
+
+// Events returns an instance of every event with an applier
+func (h *Handlers[A]) Events() []interface{} {
+	events := make([]interface{}, 0, len(h.eventTypes))
+	for _, t := range h.eventTypes {
+		events = append(events, newInstance(t))
+	}
+	return events
+}
+
+// newInstance returns a pointer to a new value for pointer types and the
+// zero value for anything else
+func newInstance(t reflect.Type) interface{} {
+	if t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem()).Interface()
+	}
+	return reflect.Zero(t).Interface()
+}
@@ -0,0 +1,119 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type Increment struct {
+	BaseCommand
+
+	By int
+}
+
+type Incremented struct {
+	By int
+}
+
+// Counter routes through a typed handler table
+type Counter struct {
+	BaseAggregateSourced
+
+	Total int
+}
+
+var counterHandlers = NewHandlers[*Counter]()
+
+func init() {
+	On(counterHandlers, func(ctx context.Context, a *Counter, cmd *Increment) error {
+		if cmd.By <= 0 {
+			return errors.New("By must be positive")
+		}
+		a.StoreEvent(&Incremented{By: cmd.By})
+		return nil
+	})
+	Apply(counterHandlers, func(a *Counter, e *Incremented) {
+		a.Total += e.By
+	})
+}
+
+func (a *Counter) HandleCommand(ctx context.Context, cmd Command) error {
+	return counterHandlers.HandleCommand(ctx, a, cmd)
+}
+func (a *Counter) ApplyEvent(ctx context.Context, data interface{}) error {
+	return counterHandlers.ApplyEvent(ctx, a, data)
+}
+
+func TestHandlersRouting(t *testing.T) {
+	ctx := context.Background()
+	counter := &Counter{}
+
+	if err := counter.HandleCommand(ctx, &Increment{By: 2}); err != nil {
+		t.Fatal(err)
+	}
+	events := counter.Events()
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if err := counter.ApplyEvent(ctx, events[0].Data); err != nil {
+		t.Fatal(err)
+	}
+	if counter.Total != 2 {
+		t.Errorf("got total %d, want 2", counter.Total)
+	}
+
+	if err := counter.HandleCommand(ctx, &Increment{By: -1}); err == nil {
+		t.Error("expected the handler error")
+	}
+}
+
+func TestHandlersUnhandled(t *testing.T) {
+	ctx := context.Background()
+	counter := &Counter{}
+
+	if err := counter.HandleCommand(ctx, &TickCommand{}); !errors.Is(err, ErrUnhandledCommand) {
+		t.Errorf("got %v, want ErrUnhandledCommand", err)
+	}
+	if err := counter.ApplyEvent(ctx, &EventTested{}); !errors.Is(err, ErrUnhandledEvent) {
+		t.Errorf("got %v, want ErrUnhandledEvent", err)
+	}
+}
+
+func TestHandlersDeclarations(t *testing.T) {
+	commands := counterHandlers.Commands()
+	if len(commands) != 1 {
+		t.Fatalf("got %d commands, want 1", len(commands))
+	}
+	if _, ok := commands[0].(*Increment); !ok {
+		t.Errorf("got %T, want *Increment", commands[0])
+	}
+
+	events := counterHandlers.Events()
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if _, ok := events[0].(*Incremented); !ok {
+		t.Errorf("got %T, want *Incremented", events[0])
+	}
+}
+
+func TestTypedAggregateStore(t *testing.T) {
+	store := NewTypedAggregateStore[*TestAggregate](&TestDataStore{}, &TestBus{})
+
+	aggregate, err := store.LoadAggregate(context.Background(), "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aggregate.GetID() != "1" {
+		t.Errorf("got id %q, want 1", aggregate.GetID())
+	}
+	if err := store.SaveAggregate(context.Background(), aggregate); err != nil {
+		t.Fatal(err)
+	}
+
+	other := AsTypedAggregateStore[*Counter](NewAggregateStore(NewAggregateFactory(&TestAggregate{}), &TestDataStore{}, nil))
+	if _, err := other.LoadAggregate(context.Background(), "1"); err != ErrInvalidAggregateType {
+		t.Errorf("got %v, want ErrInvalidAggregateType", err)
+	}
+}
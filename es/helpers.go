@@ -22,7 +22,8 @@ func GetTypeName(source interface{}) (reflect.Type, string) {
 	return rawType, parts[1]
 }
 
-// GetTimestamp will get the current timestamp
+// GetTimestamp will get the current timestamp of the system clock, use Now
+// when a context is at hand so the clock can be swapped
 func GetTimestamp() time.Time {
-	return time.Now() // TODO make this changable. Use ambient context type of thing
+	return SystemClock().Now()
 }
@@ -0,0 +1,292 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/contextgg/go-es/es"
+)
+
+const (
+	// DefaultBasePath is where the handler expects to be mounted
+	DefaultBasePath = "/commands/"
+	// DefaultMaxBodySize is the largest command accepted
+	DefaultMaxBodySize = 1 << 20
+)
+
+// Validator is implemented by commands that check their own fields, a
+// failure is returned as 422 Unprocessable Entity
+type Validator interface {
+	Validate() error
+}
+
+// StatusCoder is implemented by errors that know their HTTP status
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// Option so we can configure the handler
+type Option = func(*Handler)
+
+// BasePath sets the path prefix stripped before reading the command name
+// and aggregate ID, it defaults to DefaultBasePath
+func BasePath(path string) Option {
+	return func(h *Handler) {
+		h.basePath = path
+	}
+}
+
+// ErrorStatus sets the function mapping an error to a status code, it's
+// called before the defaults and 0 means use the default
+func ErrorStatus(fn func(error) int) Option {
+	return func(h *Handler) {
+		h.errorStatus = fn
+	}
+}
+
+// MaxBodySize sets the largest command body accepted in bytes
+func MaxBodySize(n int64) Option {
+	return func(h *Handler) {
+		h.maxBodySize = n
+	}
+}
+
+// TenantFrom sets the function reading the tenant of a request, like a
+// header or the host, an empty tenant leaves the context as is
+func TenantFrom(fn func(*http.Request) string) Option {
+	return func(h *Handler) {
+		h.tenantFrom = fn
+	}
+}
+
+// WithLogger sets the logger used when the request context has none
+func WithLogger(logger es.Logger) Option {
+	return func(h *Handler) {
+		h.logger = logger
+	}
+}
+
+// Handler decodes POST {basePath}{name}/{id} into the command registered
+// under name and dispatches it through the command bus
+type Handler struct {
+	bus         es.CommandBus
+	basePath    string
+	maxBodySize int64
+	errorStatus func(error) int
+	tenantFrom  func(*http.Request) string
+	logger      es.Logger
+}
+
+// NewHandler creates the command gateway
+func NewHandler(bus es.CommandBus, opts ...Option) *Handler {
+	h := &Handler{
+		bus:         bus,
+		basePath:    DefaultBasePath,
+		maxBodySize: DefaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Response is written after a command was handled, Version is the version
+// of the aggregate after the command and is also sent as the ETag
+type Response struct {
+	AggregateID string `json:"aggregate_id"`
+	Version     int    `json:"version,omitempty"`
+}
+
+// ETag of an aggregate at a version
+func ETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// versionSetter is implemented by commands taking an If-Match header as
+// their expected version, like es.BaseVersionedCommand
+type versionSetter interface {
+	SetExpectedVersion(int)
+}
+
+func parseETag(etag string) (int, error) {
+	etag = strings.TrimPrefix(etag, "W/")
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return 0, errBadETag
+	}
+	version, err := strconv.Atoi(etag[1 : len(etag)-1])
+	if err != nil {
+		return 0, errBadETag
+	}
+	return version, nil
+}
+
+// ErrorResponse is written when a command fails
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+var (
+	errBadPath    = errors.New("Expected a path like /commands/{name}/{id}")
+	errMissingID  = errors.New("Missing aggregate ID")
+	errNotAllowed = errors.New("Only POST is allowed")
+	errNoIfMatch  = errors.New("The command doesn't take an expected version")
+	errBadETag    = errors.New("Expected If-Match to be an ETag like \"3\"")
+)
+
+// ServeHTTP handles one command
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if h.tenantFrom != nil {
+		if tenant := h.tenantFrom(r); len(tenant) > 0 {
+			ctx = es.WithTenant(ctx, tenant)
+		}
+	}
+	logger := es.LoggerFromContext(ctx, h.logger)
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.writeError(w, http.StatusMethodNotAllowed, errNotAllowed)
+		return
+	}
+
+	name, id, ok := h.parsePath(r.URL.Path)
+	if !ok {
+		h.writeError(w, http.StatusNotFound, errBadPath)
+		return
+	}
+
+	cmd, err := h.bus.NewCommand(name)
+	if err == nil {
+		// replays rebuild state and are for operators, not clients
+		if _, ok := cmd.(*es.ReplayCommand); ok {
+			err = es.ErrCommandNotFound
+		}
+	}
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, h.maxBodySize)
+	if err := json.NewDecoder(body).Decode(cmd); err != nil && err != io.EOF {
+		h.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(id) > 0 {
+		if settable, ok := cmd.(es.SettableID); ok {
+			settable.SetID(id)
+		}
+	}
+	if len(cmd.GetAggregateID()) == 0 {
+		h.writeError(w, http.StatusBadRequest, errMissingID)
+		return
+	}
+	if match := r.Header.Get("If-Match"); len(match) > 0 && match != "*" {
+		settable, ok := cmd.(versionSetter)
+		if !ok {
+			h.writeError(w, http.StatusPreconditionFailed, errNoIfMatch)
+			return
+		}
+		version, err := parseETag(match)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		settable.SetExpectedVersion(version)
+	}
+
+	if v, ok := cmd.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			h.writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	result, err := h.bus.HandleCommandWithResult(ctx, cmd)
+	if err != nil {
+		status := h.status(err)
+		if status >= http.StatusInternalServerError {
+			logger.Error("Could not handle command",
+				"error", err,
+				"command", name,
+				"aggregate_id", cmd.GetAggregateID(),
+			)
+		}
+		var conflict *es.VersionConflictError
+		if errors.As(err, &conflict) {
+			w.Header().Set("ETag", ETag(conflict.Actual))
+		}
+		h.writeError(w, status, err)
+		return
+	}
+
+	if result.Version > 0 {
+		w.Header().Set("ETag", ETag(result.Version))
+	}
+	writeJSON(w, http.StatusOK, &Response{
+		AggregateID: result.AggregateID,
+		Version:     result.Version,
+	})
+}
+
+// parsePath returns the command name and the optional aggregate ID
+func (h *Handler) parsePath(path string) (string, string, bool) {
+	if !strings.HasPrefix(path, h.basePath) {
+		return "", "", false
+	}
+	parts := strings.Split(strings.Trim(path[len(h.basePath):], "/"), "/")
+	switch {
+	case len(parts) == 1 && len(parts[0]) > 0:
+		return parts[0], "", true
+	case len(parts) == 2 && len(parts[0]) > 0:
+		return parts[0], parts[1], true
+	}
+	return "", "", false
+}
+
+// status maps an error from the command bus to a status code
+func (h *Handler) status(err error) int {
+	if h.errorStatus != nil {
+		if status := h.errorStatus(err); status != 0 {
+			return status
+		}
+	}
+
+	var coder StatusCoder
+	switch {
+	case errors.As(err, &coder):
+		return coder.StatusCode()
+	case errors.Is(err, es.ErrVersionMismatch):
+		return http.StatusConflict
+	case errors.Is(err, es.ErrCommandNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, es.ErrAggregateExists):
+		return http.StatusConflict
+	case errors.Is(err, es.ErrAggregateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, es.ErrAggregateDeleted):
+		return http.StatusGone
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError hides the details of server errors, they are logged instead
+func (h *Handler) writeError(w http.ResponseWriter, status int, err error) {
+	msg := err.Error()
+	if status >= http.StatusInternalServerError {
+		msg = http.StatusText(status)
+	}
+	writeJSON(w, status, &ErrorResponse{
+		Error: msg,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,177 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/contextgg/go-es/es"
+)
+
+type TryLoginCommand struct {
+	es.BaseVersionedCommand
+
+	Username string `json:"username"`
+}
+
+func (c *TryLoginCommand) Validate() error {
+	if len(c.Username) == 0 {
+		return errors.New("username is required")
+	}
+	return nil
+}
+
+type statusError int
+
+func (e statusError) Error() string   { return "status error" }
+func (e statusError) StatusCode() int { return int(e) }
+
+func newBus(t *testing.T, fn func(context.Context, es.Command) error) es.CommandBus {
+	bus := es.NewCommandBus()
+	if err := bus.SetHandler(es.CommandHandlerFunc(fn), &TryLoginCommand{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.SetHandler(es.CommandHandlerFunc(fn), &es.ReplayCommand{}); err != nil {
+		t.Fatal(err)
+	}
+	return bus
+}
+
+func TestHandlerDispatches(t *testing.T) {
+	var got *TryLoginCommand
+	bus := newBus(t, func(ctx context.Context, cmd es.Command) error {
+		got = cmd.(*TryLoginCommand)
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/commands/trylogin/42", strings.NewReader(`{"username":"bob"}`))
+	rec := httptest.NewRecorder()
+	NewHandler(bus).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	if got == nil || got.AggregateID != "42" || got.Username != "bob" {
+		t.Errorf("got command %+v", got)
+	}
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"aggregate_id":"42"}` {
+		t.Errorf("got body %s", body)
+	}
+}
+
+func TestHandlerStatusCodes(t *testing.T) {
+	data := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		err    error
+		status int
+	}{
+		{"wrong method", http.MethodGet, "/commands/trylogin/1", "", nil, http.StatusMethodNotAllowed},
+		{"bad path", http.MethodPost, "/commands/trylogin/1/2", "", nil, http.StatusNotFound},
+		{"unknown command", http.MethodPost, "/commands/logout/1", "", nil, http.StatusNotFound},
+		{"replay is hidden", http.MethodPost, "/commands/replay/1", "", nil, http.StatusNotFound},
+		{"bad json", http.MethodPost, "/commands/trylogin/1", `{`, nil, http.StatusBadRequest},
+		{"missing id", http.MethodPost, "/commands/trylogin", `{"username":"bob"}`, nil, http.StatusBadRequest},
+		{"id in body", http.MethodPost, "/commands/trylogin", `{"aggregate_id":"1","username":"bob"}`, nil, http.StatusOK},
+		{"validation", http.MethodPost, "/commands/trylogin/1", `{}`, nil, http.StatusUnprocessableEntity},
+		{"version conflict", http.MethodPost, "/commands/trylogin/1", `{"username":"bob"}`, es.ErrVersionMismatch, http.StatusConflict},
+		{"already exists", http.MethodPost, "/commands/trylogin/1", `{"username":"bob"}`, es.ErrAggregateExists, http.StatusConflict},
+		{"deleted", http.MethodPost, "/commands/trylogin/1", `{"username":"bob"}`, es.ErrAggregateDeleted, http.StatusGone},
+		{"status coder", http.MethodPost, "/commands/trylogin/1", `{"username":"bob"}`, statusError(http.StatusForbidden), http.StatusForbidden},
+		{"internal", http.MethodPost, "/commands/trylogin/1", `{"username":"bob"}`, errors.New("secret"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range data {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := newBus(t, func(context.Context, es.Command) error {
+				return tt.err
+			})
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			NewHandler(bus, WithLogger(es.NopLogger())).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("got %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if strings.Contains(rec.Body.String(), "secret") {
+				t.Errorf("internal error leaked: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestHandlerErrorStatus(t *testing.T) {
+	errLocked := errors.New("locked")
+	bus := newBus(t, func(context.Context, es.Command) error {
+		return errLocked
+	})
+	handler := NewHandler(bus, BasePath("/api/"), ErrorStatus(func(err error) int {
+		if errors.Is(err, errLocked) {
+			return http.StatusLocked
+		}
+		return 0
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/trylogin/1", strings.NewReader(`{"username":"bob"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusLocked {
+		t.Errorf("got %d, want %d", rec.Code, http.StatusLocked)
+	}
+}
+
+func TestHandlerETag(t *testing.T) {
+	bus := newBus(t, func(ctx context.Context, cmd es.Command) error {
+		es.CommandResultFromContext(ctx).Version = 3
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/commands/trylogin/42", strings.NewReader(`{"username":"bob"}`))
+	rec := httptest.NewRecorder()
+	NewHandler(bus).ServeHTTP(rec, req)
+
+	if etag := rec.Header().Get("ETag"); etag != `"3"` {
+		t.Errorf("got ETag %s", etag)
+	}
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"aggregate_id":"42","version":3}` {
+		t.Errorf("got body %s", body)
+	}
+}
+
+func TestHandlerIfMatch(t *testing.T) {
+	bus := newBus(t, func(ctx context.Context, cmd es.Command) error {
+		expected, ok := cmd.(es.ExpectedVersion).GetExpectedVersion()
+		if !ok || expected != 3 {
+			t.Errorf("got expected version %d %v", expected, ok)
+		}
+		return &es.VersionConflictError{Expected: expected, Actual: 5}
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/commands/trylogin/42", strings.NewReader(`{"username":"bob"}`))
+	req.Header.Set("If-Match", `"3"`)
+	rec := httptest.NewRecorder()
+	NewHandler(bus).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("got %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if etag := rec.Header().Get("ETag"); etag != `"5"` {
+		t.Errorf("got ETag %s", etag)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/commands/trylogin/42", strings.NewReader(`{"username":"bob"}`))
+	req.Header.Set("If-Match", `3`)
+	rec = httptest.NewRecorder()
+	NewHandler(bus).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
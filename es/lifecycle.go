@@ -0,0 +1,97 @@
+package es
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrAggregateExists when a creation command targets an aggregate that has events
+	ErrAggregateExists = errors.New("Aggregate already exists")
+	// ErrAggregateNotFound when a command needs an aggregate that has no events
+	ErrAggregateNotFound = errors.New("Aggregate not found")
+	// ErrAggregateDeleted when a command targets an aggregate with a tombstone
+	ErrAggregateDeleted = errors.New("Aggregate deleted")
+	// ErrAggregateDeleterNotSupported when the datastore can't remove the
+	// projection of a deleted aggregate
+	ErrAggregateDeleterNotSupported = errors.New("DataStore does not support deleting aggregates")
+)
+
+// MustNotExist is implemented by commands that create their aggregate
+type MustNotExist interface {
+	MustNotExist()
+}
+
+// MustExist is implemented by commands that need their aggregate to exist
+type MustExist interface {
+	MustExist()
+}
+
+// BaseCreateCommand is a BaseCommand that fails when the aggregate exists
+type BaseCreateCommand struct {
+	BaseCommand
+}
+
+// MustNotExist marks the command as creating its aggregate
+func (c *BaseCreateCommand) MustNotExist() {}
+
+// Tombstone is stored by an aggregate to delete itself, every later command
+// fails with ErrAggregateDeleted and its projection is removed. es.ApplyEvent
+// handles it so it never reaches the aggregate.
+type Tombstone struct {
+	Reason string `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// Deletable is implemented by aggregates that can be deleted with a Tombstone
+type Deletable interface {
+	IsDeleted() bool
+	MarkDeleted()
+}
+
+// AggregateDeleter is implemented by datastores that can remove a projection
+type AggregateDeleter interface {
+	DeleteAggregate(context.Context, Aggregate) error
+}
+
+func isDeleted(aggregate AggregateSourced) bool {
+	d, ok := aggregate.(Deletable)
+	return ok && d.IsDeleted()
+}
+
+// ApplyEvent applies the event data to the aggregate and increments its version,
+// a Tombstone marks the aggregate deleted instead of reaching ApplyEvent
+func ApplyEvent(ctx context.Context, aggregate AggregateSourced, data interface{}) error {
+	if _, ok := data.(*Tombstone); ok {
+		if d, ok := aggregate.(Deletable); ok {
+			d.MarkDeleted()
+		}
+		aggregate.IncrementVersion()
+		return nil
+	}
+
+	if err := aggregate.ApplyEvent(ctx, data); err != nil {
+		return err
+	}
+	aggregate.IncrementVersion()
+	return nil
+}
+
+// CheckLifecycle fails commands that don't fit the state of the aggregate,
+// replays always go through
+func CheckLifecycle(aggregate AggregateSourced, cmd Command) error {
+	if _, ok := cmd.(*ReplayCommand); ok {
+		return nil
+	}
+	if isDeleted(aggregate) {
+		return ErrAggregateDeleted
+	}
+
+	exists := aggregate.GetVersion() > 0
+	if _, ok := cmd.(MustNotExist); ok && exists {
+		return ErrAggregateExists
+	}
+	if _, ok := cmd.(MustExist); ok && !exists {
+		return ErrAggregateNotFound
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// EventLogStore keeps the events and projections in memory
+type EventLogStore struct {
+	TestDataStore
+
+	events    []*Event
+	projected map[string]Aggregate
+}
+
+func (d *EventLogStore) SaveEvents(ctx context.Context, events []*Event, version int) error {
+	d.events = append(d.events, events...)
+	return nil
+}
+func (d *EventLogStore) LoadEvents(ctx context.Context, id string, typeName string, version int) ([]*Event, error) {
+	var events []*Event
+	for _, e := range d.events {
+		if e.AggregateID == id && e.Version > version {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+func (d *EventLogStore) SaveAggregate(ctx context.Context, aggregate Aggregate) error {
+	d.projected[aggregate.GetID()] = aggregate
+	return nil
+}
+func (d *EventLogStore) DeleteAggregate(ctx context.Context, aggregate Aggregate) error {
+	delete(d.projected, aggregate.GetID())
+	return nil
+}
+
+type OpenAccount struct {
+	BaseCreateCommand
+}
+
+type CloseAccount struct {
+	BaseCommand
+}
+
+func (c *CloseAccount) MustExist() {}
+
+type AccountOpened struct{}
+
+type Account struct {
+	BaseAggregateSourced
+}
+
+func (a *Account) HandleCommand(ctx context.Context, cmd Command) error {
+	switch cmd.(type) {
+	case *OpenAccount:
+		a.StoreEvent(&AccountOpened{})
+	case *CloseAccount:
+		a.StoreEvent(&Tombstone{Reason: "closed"})
+	}
+	return nil
+}
+func (a *Account) ApplyEvent(ctx context.Context, data interface{}) error {
+	switch data.(type) {
+	case *AccountOpened:
+		return nil
+	}
+	return ErrUnhandledEvent
+}
+
+func TestAggregateLifecycle(t *testing.T) {
+	decorators := map[string]func(DataStore) DataStore{
+		"plain":           func(d DataStore) DataStore { return d },
+		"async snapshots": NewAsyncSnapshotStore,
+	}
+	for name, decorate := range decorators {
+		t.Run(name, func(t *testing.T) {
+			testAggregateLifecycle(t, decorate)
+		})
+	}
+}
+
+func testAggregateLifecycle(t *testing.T, decorate func(DataStore) DataStore) {
+	store := &EventLogStore{projected: make(map[string]Aggregate)}
+	factory := NewAggregateSourcedFactory(NewAggregateSourcedFunc(&Account{}))
+	handler := NewAggregateHandler(factory, decorate(store), &TestBus{}, "", nil, true)
+	ctx := context.Background()
+
+	open := &OpenAccount{}
+	open.SetID("1")
+	closeAccount := &CloseAccount{BaseCommand{AggregateID: "1"}}
+
+	data := []struct {
+		name      string
+		cmd       Command
+		err       error
+		projected bool
+	}{
+		{"close before open", closeAccount, ErrAggregateNotFound, false},
+		{"open", open, nil, true},
+		{"open twice", open, ErrAggregateExists, true},
+		{"close", closeAccount, nil, false},
+		{"close after delete", closeAccount, ErrAggregateDeleted, false},
+		{"open after delete", open, ErrAggregateDeleted, false},
+		{"replay after delete", &ReplayCommand{BaseCommand{AggregateID: "1"}}, nil, false},
+	}
+
+	for _, d := range data {
+		err := handler.HandleCommand(ctx, d.cmd)
+		if !errors.Is(err, d.err) {
+			t.Errorf("%s: expected %v, got %v", d.name, d.err, err)
+		}
+		if _, ok := store.projected["1"]; ok != d.projected {
+			t.Errorf("%s: expected projected %v", d.name, d.projected)
+		}
+	}
+
+	if len(store.events) != 2 {
+		t.Errorf("got %d events, want 2", len(store.events))
+	}
+}
+
+// projectionStore can save projections but not delete them
+type projectionStore struct {
+	DataStore
+}
+
+func TestAggregateLifecycleWithoutDeleter(t *testing.T) {
+	store := &EventLogStore{projected: make(map[string]Aggregate)}
+	factory := NewAggregateSourcedFactory(NewAggregateSourcedFunc(&Account{}))
+	handler := NewAggregateHandler(factory, &projectionStore{store}, &TestBus{}, "", nil, true)
+
+	logger := NewRecordingLogger()
+	ctx := WithLogger(context.Background(), logger)
+
+	open := &OpenAccount{}
+	open.SetID("1")
+	if err := handler.HandleCommand(ctx, open); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.HandleCommand(ctx, &CloseAccount{BaseCommand{AggregateID: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the deleted aggregate is never projected
+	if projected, ok := store.projected["1"]; !ok || projected.(*Account).GetVersion() != 1 {
+		t.Errorf("expected the projection of the open account, got %v", projected)
+	}
+	if len(*logger.lines) != 1 {
+		t.Errorf("expected the missing deleter to be logged, got %v", *logger.lines)
+	}
+}
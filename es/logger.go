@@ -0,0 +1,109 @@
+package es
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Logger is the structured logger used across go-es. Fields are passed as
+// alternating keys and values, the way slog and zap's SugaredLogger take
+// them, so adapting either is a few lines of code.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+	With(keyvals ...interface{}) Logger
+}
+
+// DefaultLogger logs through the global zerolog logger without changing its level
+func DefaultLogger() Logger {
+	return &zerologLogger{&log.Logger}
+}
+
+// ZerologLogger adapts a zerolog logger
+func ZerologLogger(logger zerolog.Logger) Logger {
+	return &zerologLogger{&logger}
+}
+
+type zerologLogger struct {
+	logger *zerolog.Logger
+}
+
+func (l *zerologLogger) Debug(msg string, keyvals ...interface{}) {
+	l.logger.Debug().Fields(fieldMap(keyvals)).Msg(msg)
+}
+func (l *zerologLogger) Info(msg string, keyvals ...interface{}) {
+	l.logger.Info().Fields(fieldMap(keyvals)).Msg(msg)
+}
+func (l *zerologLogger) Error(msg string, keyvals ...interface{}) {
+	l.logger.Error().Fields(fieldMap(keyvals)).Msg(msg)
+}
+func (l *zerologLogger) With(keyvals ...interface{}) Logger {
+	logger := l.logger.With().Fields(fieldMap(keyvals)).Logger()
+	return &zerologLogger{&logger}
+}
+
+func fieldMap(keyvals []interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, len(keyvals)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		if i+1 == len(keyvals) {
+			fields["!BADKEY"] = keyvals[i]
+			break
+		}
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		fields[key] = keyvals[i+1]
+	}
+	return fields
+}
+
+// NopLogger discards everything
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+func (l nopLogger) With(...interface{}) Logger {
+	return l
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a context carrying the logger
+func WithLogger(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext returns the logger in ctx, falling back to fallback and
+// then the DefaultLogger when there is none
+func LoggerFromContext(ctx context.Context, fallback Logger) Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(Logger); ok && logger != nil {
+		return logger
+	}
+	if fallback != nil {
+		return fallback
+	}
+	return DefaultLogger()
+}
+
+// LoggerMiddleware puts the logger in the context of every command, a logger
+// already in the context is kept so callers can add their own fields
+func LoggerMiddleware(logger Logger) CommandHandlerMiddleware {
+	return func(h CommandHandler) CommandHandler {
+		return CommandHandlerFunc(func(ctx context.Context, cmd Command) error {
+			if _, ok := ctx.Value(loggerKey{}).(Logger); !ok {
+				ctx = WithLogger(ctx, logger)
+			}
+			return h.HandleCommand(ctx, cmd)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+type logLine struct {
+	msg     string
+	keyvals []interface{}
+}
+
+// RecordingLogger keeps every line logged at any level
+type RecordingLogger struct {
+	lines *[]logLine
+	with  []interface{}
+}
+
+func NewRecordingLogger() *RecordingLogger {
+	return &RecordingLogger{lines: &[]logLine{}}
+}
+
+func (l *RecordingLogger) log(msg string, keyvals []interface{}) {
+	*l.lines = append(*l.lines, logLine{msg, append(append([]interface{}{}, l.with...), keyvals...)})
+}
+func (l *RecordingLogger) Debug(msg string, keyvals ...interface{}) { l.log(msg, keyvals) }
+func (l *RecordingLogger) Info(msg string, keyvals ...interface{})  { l.log(msg, keyvals) }
+func (l *RecordingLogger) Error(msg string, keyvals ...interface{}) { l.log(msg, keyvals) }
+func (l *RecordingLogger) With(keyvals ...interface{}) Logger {
+	return &RecordingLogger{l.lines, append(append([]interface{}{}, l.with...), keyvals...)}
+}
+
+func TestZerologLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := ZerologLogger(zerolog.New(&buf)).With("id", "1")
+	logger.Error("failed", "error", errors.New("boom"), "version", 2, "dangling")
+
+	out := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"level":   "error",
+		"message": "failed",
+		"id":      "1",
+		"error":   "boom",
+		"version": float64(2),
+		"!BADKEY": "dangling",
+	}
+	for k, v := range want {
+		if out[k] != v {
+			t.Errorf("%s: got %v, want %v", k, out[k], v)
+		}
+	}
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	fallback := NewRecordingLogger()
+	if got := LoggerFromContext(context.Background(), fallback); got != fallback {
+		t.Errorf("expected the fallback logger")
+	}
+
+	logger := NewRecordingLogger()
+	ctx := WithLogger(context.Background(), logger)
+	if got := LoggerFromContext(ctx, fallback); got != logger {
+		t.Errorf("expected the context logger")
+	}
+}
+
+func TestLoggerMiddlewareKeepsCallerLogger(t *testing.T) {
+	caller := NewRecordingLogger()
+	handler := UseCommandHandlerMiddleware(
+		CommandHandlerFunc(func(ctx context.Context, cmd Command) error {
+			LoggerFromContext(ctx, nil).Info("handled")
+			return nil
+		}),
+		LoggerMiddleware(NewRecordingLogger()),
+	)
+
+	ctx := WithLogger(context.Background(), caller)
+	if err := handler.HandleCommand(ctx, &TickCommand{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*caller.lines) != 1 {
+		t.Errorf("got %d lines, want 1", len(*caller.lines))
+	}
+}
+
+func TestAggregateStoreLogger(t *testing.T) {
+	logger := NewRecordingLogger()
+	store := NewAggregateStore(nil, &TestDataStore{}, &TestBus{}, AggregateStoreLogger(logger))
+
+	aggregate := &TestAggregate{}
+	aggregate.PublishEvent(NewEvent(&EventTested{"Hello"}))
+	if err := store.SaveAggregate(context.Background(), aggregate); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := *logger.lines
+	if len(lines) == 0 {
+		t.Fatal("nothing was logged")
+	}
+	if last := lines[len(lines)-1]; last.msg != "SaveAggregate successful" {
+		t.Errorf("got %q, want SaveAggregate successful", last.msg)
+	}
+}
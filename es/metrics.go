@@ -0,0 +1,178 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds the prometheus collectors for commands, events, stores and publishers
+type Metrics struct {
+	CommandsHandled  *prometheus.CounterVec
+	CommandDuration  *prometheus.HistogramVec
+	EventsStored     *prometheus.CounterVec
+	EventsPublished  *prometheus.CounterVec
+	PublishDuration  *prometheus.HistogramVec
+	VersionConflicts *prometheus.CounterVec
+	SnapshotLoads    *prometheus.CounterVec
+	EventsReplayed   *prometheus.HistogramVec
+}
+
+// NewMetrics creates the collectors, names are prefixed with namespace
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		CommandsHandled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "commands_handled_total",
+			Help:      "Commands handled by type and outcome.",
+		}, []string{"command", "outcome"}),
+		CommandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "command_duration_seconds",
+			Help:      "Time taken to handle a command.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"command"}),
+		EventsStored: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_stored_total",
+			Help:      "Events saved to the data store by type.",
+		}, []string{"event"}),
+		EventsPublished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_published_total",
+			Help:      "Events sent to publishers by type and outcome.",
+		}, []string{"event", "outcome"}),
+		PublishDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "publish_duration_seconds",
+			Help:      "Time taken by a publisher to publish an event.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"publisher"}),
+		VersionConflicts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "version_conflicts_total",
+			Help:      "Events rejected by the data store because of a version conflict.",
+		}, []string{"aggregate"}),
+		SnapshotLoads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "snapshot_loads_total",
+			Help:      "Snapshot loads by aggregate and result (hit or miss).",
+		}, []string{"aggregate", "result"}),
+		EventsReplayed: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "events_replayed",
+			Help:      "Events loaded and applied to rebuild an aggregate.",
+			Buckets:   []float64{0, 1, 5, 10, 25, 50, 100, 250, 500, 1000, 5000},
+		}, []string{"aggregate"}),
+	}
+}
+
+// Collectors returns every collector so they can be registered
+func (m *Metrics) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.CommandsHandled,
+		m.CommandDuration,
+		m.EventsStored,
+		m.EventsPublished,
+		m.PublishDuration,
+		m.VersionConflicts,
+		m.SnapshotLoads,
+		m.EventsReplayed,
+	}
+}
+
+// Register all the collectors with reg
+func (m *Metrics) Register(reg prometheus.Registerer) error {
+	for _, c := range m.Collectors() {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type metricsKey struct{}
+
+// WithMetrics returns a context carrying the metrics
+func WithMetrics(ctx context.Context, m *Metrics) context.Context {
+	return context.WithValue(ctx, metricsKey{}, m)
+}
+
+// MetricsFromContext returns the metrics in ctx or nil when they're disabled
+func MetricsFromContext(ctx context.Context) *Metrics {
+	m, _ := ctx.Value(metricsKey{}).(*Metrics)
+	return m
+}
+
+// CommandMetricsMiddleware counts and times every command
+func CommandMetricsMiddleware(m *Metrics) CommandHandlerMiddleware {
+	return func(h CommandHandler) CommandHandler {
+		return CommandHandlerFunc(func(ctx context.Context, cmd Command) error {
+			_, name := GetTypeName(cmd)
+
+			start := time.Now()
+			err := h.HandleCommand(WithMetrics(ctx, m), cmd)
+			m.CommandDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+			m.CommandsHandled.WithLabelValues(name, outcome(err)).Inc()
+			return err
+		})
+	}
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+func (m *Metrics) snapshotLoaded(aggregateType string, version int) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if version > 0 {
+		result = "hit"
+	}
+	m.SnapshotLoads.WithLabelValues(aggregateType, result).Inc()
+}
+
+func (m *Metrics) eventsReplayed(aggregateType string, count int) {
+	if m == nil {
+		return
+	}
+	m.EventsReplayed.WithLabelValues(aggregateType).Observe(float64(count))
+}
+
+func (m *Metrics) versionConflict(aggregateType string) {
+	if m == nil {
+		return
+	}
+	m.VersionConflicts.WithLabelValues(aggregateType).Inc()
+}
+
+func (m *Metrics) eventsSaved(aggregateType string, events []*Event, err error) {
+	if m == nil {
+		return
+	}
+	if errors.Is(err, ErrVersionMismatch) {
+		m.versionConflict(aggregateType)
+	}
+	if err != nil {
+		return
+	}
+	for _, e := range events {
+		m.EventsStored.WithLabelValues(e.Type).Inc()
+	}
+}
+
+func (m *Metrics) eventPublished(publisher EventPublisher, evt *Event, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	t, _ := GetTypeName(publisher)
+	m.PublishDuration.WithLabelValues(t.String()).Observe(time.Since(start).Seconds())
+	m.EventsPublished.WithLabelValues(evt.Type, outcome(err)).Inc()
+}
@@ -0,0 +1,85 @@
+package es
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type ConflictDataStore struct {
+	TestDataStore
+}
+
+func (d *ConflictDataStore) SaveEvents(context.Context, []*Event, int) error {
+	return ErrVersionMismatch
+}
+
+type NopPublisher struct{}
+
+func (p *NopPublisher) PublishEvent(context.Context, *Event) error { return nil }
+func (p *NopPublisher) Close()                                     {}
+
+func TestCommandMetrics(t *testing.T) {
+	m := NewMetrics("test")
+	if err := m.Register(prometheus.NewRegistry()); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewEventRegistry()
+	registry.Set(&EventTested{}, false)
+	bus := NewEventBus(registry, &TestBus{})
+	bus.AddPublisher(&NopPublisher{})
+
+	factory := NewAggregateSourcedFactory(NewAggregateSourcedFunc(&ClockAggregate{}))
+	handler := UseCommandHandlerMiddleware(
+		NewAggregateHandler(factory, &RecordingDataStore{}, bus, "", SnapshotEvery(10), false),
+		CommandMetricsMiddleware(m),
+	)
+	if err := handler.HandleCommand(context.Background(), &TickCommand{BaseCommand{AggregateID: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testutil.ToFloat64(m.CommandsHandled.WithLabelValues("TickCommand", "success")); got != 1 {
+		t.Errorf("commands handled: got %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.EventsStored.WithLabelValues("EventTested")); got != 1 {
+		t.Errorf("events stored: got %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.EventsPublished.WithLabelValues("EventTested", "success")); got != 1 {
+		t.Errorf("events published: got %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.SnapshotLoads.WithLabelValues("ClockAggregate", "miss")); got != 1 {
+		t.Errorf("snapshot misses: got %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(m.EventsReplayed); got != 1 {
+		t.Errorf("replay histograms: got %d, want 1", got)
+	}
+	if got := testutil.CollectAndCount(m.PublishDuration); got != 1 {
+		t.Errorf("publish histograms: got %d, want 1", got)
+	}
+}
+
+func TestVersionConflictMetrics(t *testing.T) {
+	m := NewMetrics("test")
+
+	factory := NewAggregateSourcedFactory(NewAggregateSourcedFunc(&ClockAggregate{}))
+	handler := UseCommandHandlerMiddleware(
+		NewAggregateHandler(factory, &ConflictDataStore{}, &TestBus{}, "", nil, false),
+		CommandMetricsMiddleware(m),
+	)
+	if err := handler.HandleCommand(context.Background(), &TickCommand{BaseCommand{AggregateID: "1"}}); err != ErrVersionMismatch {
+		t.Fatalf("got %v, want ErrVersionMismatch", err)
+	}
+
+	if got := testutil.ToFloat64(m.VersionConflicts.WithLabelValues("ClockAggregate")); got != 1 {
+		t.Errorf("version conflicts: got %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.CommandsHandled.WithLabelValues("TickCommand", "error")); got != 1 {
+		t.Errorf("failed commands: got %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(m.EventsStored); got != 0 {
+		t.Errorf("events stored: got %d, want 0", got)
+	}
+}
@@ -4,12 +4,12 @@ import (
 	"context"
 	"time"
 
-	"github.com/rs/zerolog/log"
-
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"github.com/contextgg/go-es/es"
 )
 
 const (
@@ -19,16 +19,21 @@ const (
 	EventsCollection = "events"
 	// SnapshotsCollection for storing snapshot
 	SnapshotsCollection = "snapshots"
+	// ArchiveCollection for storing the events moved out of EventsCollection
+	ArchiveCollection = "events_archive"
+	// KeysCollection for storing the keys of es.PII
+	KeysCollection = "keys"
 )
 
 // Create will setup a database
 func Create(uri, db, username, password string, createIndexes bool) (*mongo.Database, error) {
-	sublogger := log.With().
-		Str("uri", uri).
-		Str("db", db).
-		Str("username", username).
-		Bool("createIndexes", createIndexes).
-		Logger()
+	logger := es.DefaultLogger()
+	sublogger := logger.With(
+		"uri", uri,
+		"db", db,
+		"username", username,
+		"createIndexes", createIndexes,
+	)
 
 	opts := options.
 		Client().
@@ -43,22 +48,18 @@ func Create(uri, db, username, password string, createIndexes bool) (*mongo.Data
 	}
 
 	var err error
-	ctx, _ := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
 	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
-		sublogger.
-			Error().
-			Err(err).
-			Msg("Could not connect to db")
+		sublogger.Error("Could not connect to db", "error", err)
 		return nil, err
 	}
 
 	// test it!
 	if err := client.Ping(ctx, readpref.Primary()); err != nil {
-		sublogger.
-			Error().
-			Err(err).
-			Msg("Could not ping db")
+		sublogger.Error("Could not ping db", "error", err)
 		return nil, err
 	}
 
@@ -66,61 +67,121 @@ func Create(uri, db, username, password string, createIndexes bool) (*mongo.Data
 		Database(db)
 
 	if createIndexes {
-		indexOpts := options.
-			CreateIndexes().
-			SetMaxTime(10 * time.Second)
-
-		aggregatesIndex := mongo.IndexModel{
-			Keys: bson.M{
-				"aggregate_type": 1,
-				"aggregate_id":   1,
-			},
-			Options: options.
-				Index().
-				SetUnique(true).
-				SetName("aggreates.id.type"),
-		}
-		eventsIndex := mongo.IndexModel{
-			Keys: bson.M{
-				"aggregate_type": 1,
-				"aggregate_id":   1,
-				"version":        1,
-			},
-			Options: options.
-				Index().
-				SetUnique(true).
-				SetName("events.id.type.version"),
-		}
-		snapshotsIndex := mongo.IndexModel{
-			Keys: bson.M{
-				"aggregate_type": 1,
-				"aggregate_id":   1,
-				"revision":       1,
-			},
-			Options: options.
-				Index().
-				SetUnique(true).
-				SetName("snapshots.id.type.revision"),
-		}
-
-		database.
-			Collection(AggregatesCollection).
-			Indexes().
-			CreateOne(ctx, aggregatesIndex, indexOpts)
-		database.
-			Collection(EventsCollection).
-			Indexes().
-			CreateOne(ctx, eventsIndex, indexOpts)
-		database.
-			Collection(SnapshotsCollection).
-			Indexes().
-			CreateOne(ctx, snapshotsIndex, indexOpts)
-
-		log.Debug().
-			Msg("Indexes may have been created successfully")
+		CreateIndexes(ctx, database)
+		logger.Debug("Indexes may have been created successfully")
 	}
 
-	log.Debug().
-		Msg("Database created successfully")
+	logger.Debug("Database created successfully")
 	return database, nil
 }
+
+// CreateIndexes creates the indexes the store relies on, the unique ones are
+// scoped to the tenant. Errors are ignored since the indexes may exist.
+func CreateIndexes(ctx context.Context, database *mongo.Database) {
+	indexOpts := options.
+		CreateIndexes().
+		SetMaxTime(10 * time.Second)
+
+	aggregatesIndex := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "tenant", Value: 1},
+			{Key: "aggregate_type", Value: 1},
+			{Key: "aggregate_id", Value: 1},
+		},
+		Options: options.
+			Index().
+			SetUnique(true).
+			SetName("aggregates.tenant.id.type"),
+	}
+	eventsIndex := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "tenant", Value: 1},
+			{Key: "aggregate_type", Value: 1},
+			{Key: "aggregate_id", Value: 1},
+			{Key: "version", Value: 1},
+		},
+		Options: options.
+			Index().
+			SetUnique(true).
+			SetName("events.tenant.id.type.version"),
+	}
+	snapshotsIndex := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "tenant", Value: 1},
+			{Key: "aggregate_type", Value: 1},
+			{Key: "aggregate_id", Value: 1},
+			{Key: "revision", Value: 1},
+		},
+		Options: options.
+			Index().
+			SetUnique(true).
+			SetName("snapshots.tenant.id.type.revision"),
+	}
+	archiveIndex := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "tenant", Value: 1},
+			{Key: "aggregate_type", Value: 1},
+			{Key: "aggregate_id", Value: 1},
+			{Key: "version", Value: 1},
+		},
+		Options: options.
+			Index().
+			SetUnique(true).
+			SetName("events_archive.tenant.id.type.version"),
+	}
+	snapshotsRevisionIndex := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "tenant", Value: 1},
+			{Key: "revision", Value: 1},
+		},
+		Options: options.
+			Index().
+			SetName("snapshots.tenant.revision"),
+	}
+
+	database.
+		Collection(AggregatesCollection).
+		Indexes().
+		CreateOne(ctx, aggregatesIndex, indexOpts)
+	database.
+		Collection(EventsCollection).
+		Indexes().
+		CreateOne(ctx, eventsIndex, indexOpts)
+	database.
+		Collection(ArchiveCollection).
+		Indexes().
+		CreateOne(ctx, archiveIndex, indexOpts)
+	database.
+		Collection(SnapshotsCollection).
+		Indexes().
+		CreateOne(ctx, snapshotsIndex, indexOpts)
+	database.
+		Collection(SnapshotsCollection).
+		Indexes().
+		CreateOne(ctx, snapshotsRevisionIndex, indexOpts)
+	CreateKeyIndexes(ctx, database)
+}
+
+// CreateKeyIndexes creates the index of the keys collection, NewKeyStore
+// runs it on the database the keys are kept in
+func CreateKeyIndexes(ctx context.Context, database *mongo.Database) {
+	indexOpts := options.
+		CreateIndexes().
+		SetMaxTime(10 * time.Second)
+
+	keysIndex := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "tenant", Value: 1},
+			{Key: "subject", Value: 1},
+		},
+		Options: options.
+			Index().
+			SetUnique(true).
+			SetName("keys.tenant.subject"),
+	}
+
+	database.
+		Collection(KeysCollection).
+		Indexes().
+		CreateOne(ctx, keysIndex, indexOpts)
+}
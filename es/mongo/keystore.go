@@ -0,0 +1,79 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/contextgg/go-es/es"
+)
+
+// KeyDB is the data key of a subject
+type KeyDB struct {
+	Subject string `bson:"subject"`
+	Key     []byte `bson:"key"`
+}
+
+// NewKeyStore stores the keys of es.PII in the keys collection, keep it in
+// a database that isn't backed up with the events so erasures stick. Keys are
+// kept per tenant, the index keeping one key per subject is created here.
+func NewKeyStore(db *mongo.Database) es.KeyStore {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	CreateKeyIndexes(ctx, db)
+
+	return &keyStore{db}
+}
+
+type keyStore struct {
+	db *mongo.Database
+}
+
+func (s *keyStore) GetKey(ctx context.Context, subject string) ([]byte, error) {
+	item := &KeyDB{}
+	err := s.db.
+		Collection(KeysCollection).
+		FindOne(ctx, bson.M{"subject": subject, "tenant": tenantOf(ctx)}).
+		Decode(item)
+	if err == mongo.ErrNoDocuments {
+		return nil, es.ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item.Key, nil
+}
+
+func (s *keyStore) CreateKey(ctx context.Context, subject string) ([]byte, error) {
+	key, err := es.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// only the first writer wins, everyone reads back the same key
+	opts := options.
+		Update().
+		SetUpsert(true)
+	update := bson.M{
+		"$setOnInsert": &KeyDB{
+			Subject: subject,
+			Key:     key,
+		},
+	}
+	if _, err := s.db.
+		Collection(KeysCollection).
+		UpdateOne(ctx, bson.M{"subject": subject, "tenant": tenantOf(ctx)}, update, opts); err != nil {
+		return nil, err
+	}
+	return s.GetKey(ctx, subject)
+}
+
+func (s *keyStore) DeleteKey(ctx context.Context, subject string) error {
+	_, err := s.db.
+		Collection(KeysCollection).
+		DeleteOne(ctx, bson.M{"subject": subject, "tenant": tenantOf(ctx)})
+	return err
+}
@@ -1,23 +1,43 @@
 package mongo
 
 import (
-	"go.mongodb.org/mongo-driver/bson"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/contextgg/go-es/es"
 )
 
 // AggregateDB defines an aggregate to ensure we don't have race conditions
 type AggregateDB struct {
+	Tenant        string `bson:"tenant,omitempty"`
 	AggregateID   string `bson:"aggregate_id"`
 	AggregateType string `bson:"aggregate_type"`
 	Version       int    `bson:"version"`
 }
 
-//EventDB defines the structure of the events to be stored
+// EventDB defines the structure of the events to be stored
 type EventDB struct {
+	Tenant        string         `bson:"tenant,omitempty"`
 	AggregateID   string         `bson:"aggregate_id"`
 	AggregateType string         `bson:"aggregate_type"`
 	Type          string         `bson:"event_type"`
 	Version       int            `bson:"version"`
 	Timestamp     time.Time      `bson:"timestamp"`
 	Data          *bson.RawValue `bson:"data,omitempty"`
+	Metadata      es.Metadata    `bson:"metadata,omitempty"`
+}
+
+// SnapshotDB defines the fields of a snapshot we need to manage them
+type SnapshotDB struct {
+	AggregateID   string `bson:"aggregate_id"`
+	AggregateType string `bson:"aggregate_type"`
+	Revision      string `bson:"revision"`
+	Version       int    `bson:"version"`
+}
+
+// RawEventData is an es.EventDataFactory that decodes every payload into a
+// bson.M, so streams can be read without registering the event types
+func RawEventData(string) (interface{}, error) {
+	return &bson.M{}, nil
 }
@@ -2,9 +2,7 @@ package mongo
 
 import (
 	"context"
-	"errors"
 
-	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -12,49 +10,123 @@ import (
 	"github.com/contextgg/go-es/es"
 )
 
+// archiveBatchSize is how many events are copied to the archive at once
+const archiveBatchSize = 500
+
 var (
 	// ErrVersionMismatch when the stored version doesn't match
-	ErrVersionMismatch = errors.New("Aggregate version mismatch")
+	ErrVersionMismatch = es.ErrVersionMismatch
 )
 
+// Option so we can configure the store
+type Option = func(*store)
+
+// WithLogger sets the logger used when the context has none
+func WithLogger(logger es.Logger) Option {
+	return func(s *store) {
+		s.logger = logger
+	}
+}
+
+// WithPII encrypts the personal fields of event payloads before they are
+// written and decrypts them when loaded
+func WithPII(pii *es.PII) Option {
+	return func(s *store) {
+		s.pii = pii
+	}
+}
+
+// WithBatchSize sets how many events are fetched at once when loading a
+// stream, the server default is used when it's not set
+func WithBatchSize(size int32) Option {
+	return func(s *store) {
+		s.batchSize = size
+	}
+}
+
+// DatabasePerTenant routes every tenant to its own database, data without a
+// tenant stays in the database given to NewStore. The function is called for
+// every operation so it should cache what it returns.
+func DatabasePerTenant(fn func(tenant string) *mongo.Database) Option {
+	return func(s *store) {
+		s.tenantDB = fn
+	}
+}
+
 // NewStore generates a new store to access to mongodb
-func NewStore(db *mongo.Database, factory es.EventDataFactory) (es.DataStore, error) {
-	return &store{db, factory}, nil
+func NewStore(db *mongo.Database, factory es.EventDataFactory, opts ...Option) (es.DataStore, error) {
+	s := &store{
+		db:      db,
+		factory: factory,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
 }
 
 // Client for access to mongodb
 type store struct {
-	db      *mongo.Database
-	factory es.EventDataFactory
+	db        *mongo.Database
+	factory   es.EventDataFactory
+	logger    es.Logger
+	pii       *es.PII
+	tenantDB  func(string) *mongo.Database
+	batchSize int32
+}
+
+// database returns where the tenant of ctx is stored
+func (c *store) database(ctx context.Context) *mongo.Database {
+	if tenant := es.TenantFromContext(ctx); len(tenant) > 0 && c.tenantDB != nil {
+		return c.tenantDB(tenant)
+	}
+	return c.db
+}
+
+// tenantOf is the value of the tenant field in queries, nil matches the
+// documents written without a tenant
+func tenantOf(ctx context.Context) interface{} {
+	if tenant := es.TenantFromContext(ctx); len(tenant) > 0 {
+		return tenant
+	}
+	return nil
 }
 
 // Save the events ensuring the current version
 func (c *store) SaveEvents(ctx context.Context, events []*es.Event, version int) error {
 	if len(events) == 0 {
-		log.Debug().Msg("No events")
+		es.LoggerFromContext(ctx, c.logger).Debug("No events")
 		return nil
 	}
 
 	aggregateID := events[0].AggregateID
 	aggregateType := events[0].AggregateType
 	filter := bson.M{
+		"tenant":         tenantOf(ctx),
 		"aggregate_id":   aggregateID,
 		"aggregate_type": aggregateType,
 	}
 
-	logger := log.
-		With().
-		Str("aggregateID", aggregateID).
-		Str("aggregateType", aggregateType).
-		Int("version", version).
-		Logger()
+	logger := es.LoggerFromContext(ctx, c.logger).With(
+		"aggregateID", aggregateID,
+		"aggregateType", aggregateType,
+		"version", version,
+	)
 
 	maxVersion := version
 	items := []interface{}{}
 	for _, event := range events {
+		payload := event.Data
+		if c.pii != nil {
+			var err error
+			if payload, err = c.pii.Encrypt(ctx, event); err != nil {
+				return err
+			}
+		}
+
 		var data *bson.RawValue
-		if event.Data != nil {
-			b, err := bson.Marshal(event.Data)
+		if payload != nil {
+			b, err := bson.Marshal(payload)
 			if err != nil {
 				return err
 			}
@@ -65,12 +137,14 @@ func (c *store) SaveEvents(ctx context.Context, events []*es.Event, version int)
 		}
 
 		item := &EventDB{
+			Tenant:        es.TenantFromContext(ctx),
 			AggregateID:   event.AggregateID,
 			AggregateType: event.AggregateType,
 			Type:          event.Type,
 			Version:       event.Version,
 			Timestamp:     event.Timestamp,
 			Data:          data,
+			Metadata:      event.Metadata,
 		}
 		items = append(items, item)
 
@@ -81,24 +155,18 @@ func (c *store) SaveEvents(ctx context.Context, events []*es.Event, version int)
 
 	// load up the aggregate by ID!
 	aggregate := &AggregateDB{}
-	if err := c.db.
+	if err := c.database(ctx).
 		Collection(AggregatesCollection).
 		FindOne(ctx, filter).
 		Decode(&aggregate); err != nil && err != mongo.ErrNoDocuments {
-		logger.
-			Error().
-			Err(err).
-			Msg("Could not load aggregate")
+		logger.Error("Could not load aggregate", "error", err)
 		return err
 	}
 
-	logger.Debug().Int("version", aggregate.Version).Msg("Got a version?")
+	logger.Debug("Got a version?", "version", aggregate.Version)
 
 	if aggregate.Version != version {
-		logger.
-			Error().
-			Err(ErrVersionMismatch).
-			Msg("Version issues")
+		logger.Error("Version issues", "error", ErrVersionMismatch)
 		return ErrVersionMismatch
 	}
 	aggregate.Version = maxVersion
@@ -113,100 +181,279 @@ func (c *store) SaveEvents(ctx context.Context, events []*es.Event, version int)
 			"version":        maxVersion,
 		},
 	}
-	if _, err := c.db.
+	if _, err := c.database(ctx).
 		Collection(AggregatesCollection).
 		UpdateOne(ctx, filter, update, updateOptions); err != nil {
-		logger.
-			Error().
-			Err(err).
-			Msg("Could not insert aggregate")
+		logger.Error("Could not insert aggregate", "error", err)
 		return err
 	}
 
 	// store all events
-	if _, err := c.db.
+	if _, err := c.database(ctx).
 		Collection(EventsCollection).
 		InsertMany(ctx, items); err != nil {
-		logger.
-			Error().
-			Err(err).
-			Msg("Could not insert many events")
+		logger.Error("Could not insert many events", "error", err)
 		return err
 	}
 
-	logger.
-		Debug().
-		Msg("Success")
+	logger.Debug("Success")
 	return nil
 }
 
 // Load the events from the data store
 func (c *store) LoadEvents(ctx context.Context, id string, typeName string, fromVersion int) ([]*es.Event, error) {
-	logger := log.
-		With().
-		Str("aggregateID", id).
-		Str("aggregateType", typeName).
-		Int("fromVersion", fromVersion).
-		Logger()
-
-	events := []*es.Event{}
+	stream, err := c.LoadEventStream(ctx, id, typeName, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+	return es.CollectEvents(ctx, stream)
+}
+
+// LoadEventStream reads the events from the data store with a cursor, they
+// are fetched in batches of WithBatchSize
+func (c *store) LoadEventStream(ctx context.Context, id string, typeName string, fromVersion int) (es.EventStream, error) {
+	logger := es.LoggerFromContext(ctx, c.logger).With(
+		"aggregateID", id,
+		"aggregateType", typeName,
+		"fromVersion", fromVersion,
+	)
+
 	query := bson.M{
+		"tenant":         tenantOf(ctx),
 		"aggregate_id":   id,
 		"aggregate_type": typeName,
 		"version":        bson.M{"$gt": fromVersion},
 	}
-	cur, err := c.db.
-		Collection(EventsCollection).
-		Find(ctx, query)
+	live, err := c.findEvents(ctx, EventsCollection, query)
 	if err != nil {
-		logger.
-			Error().
-			Err(err).
-			Msg("Couldn't find events")
+		logger.Error("Couldn't find events", "error", err)
 		return nil, err
 	}
-	defer cur.Close(ctx)
+	stream := &eventStream{
+		store:   c,
+		logger:  logger,
+		cursors: []*mongo.Cursor{live},
+	}
+	if !live.Next(ctx) {
+		return stream, nil
+	}
 
-	for cur.Next(ctx) {
-		var item EventDB
-		if err := cur.Decode(&item); err != nil {
+	// a gap before the first event means the older ones were archived
+	if stream.first, err = c.decodeEvent(ctx, live, logger); err != nil {
+		live.Close(ctx)
+		return nil, err
+	}
+	if stream.first.Version > fromVersion+1 {
+		query["version"] = bson.M{"$gt": fromVersion, "$lt": stream.first.Version}
+		archived, err := c.findEvents(ctx, ArchiveCollection, query)
+		if err != nil {
+			logger.Error("Couldn't find archived events", "error", err)
+			live.Close(ctx)
 			return nil, err
 		}
+		logger.Debug("Loading archived events")
+		stream.cursors = []*mongo.Cursor{archived, live}
+	}
+	return stream, nil
+}
+
+func (c *store) findEvents(ctx context.Context, collection string, query bson.M) (*mongo.Cursor, error) {
+	opts := options.
+		Find().
+		SetSort(bson.M{"version": 1})
+	if c.batchSize > 0 {
+		opts.SetBatchSize(c.batchSize)
+	}
+	return c.database(ctx).
+		Collection(collection).
+		Find(ctx, query, opts)
+}
 
-		logger.Debug().Interface("data", item.Data).Msg("Do we have raw data")
+func (c *store) decodeEvent(ctx context.Context, cur *mongo.Cursor, logger es.Logger) (*es.Event, error) {
+	var item EventDB
+	if err := cur.Decode(&item); err != nil {
+		return nil, err
+	}
 
-		// create the even
-		data, err := c.factory(item.Type)
-		if err != nil {
-			logger.
-				Error().
-				Err(err).
-				Str("type", item.Type).
-				Msg("Issue creating the factory")
+	// create the even
+	data, err := c.factory(item.Type)
+	if err != nil {
+		logger.Error("Issue creating the factory",
+			"error", err,
+			"type", item.Type,
+		)
+		return nil, err
+	}
+
+	if item.Data != nil {
+		if err := item.Data.Unmarshal(data); err != nil {
+			logger.Error("Issue unmarshalling",
+				"error", err,
+				"type", item.Type,
+			)
 			return nil, err
 		}
+	}
 
-		if err := item.Data.Unmarshal(data); err != nil {
-			logger.
-				Error().
-				Err(err).
-				Str("type", item.Type).
-				Msg("Issue unmarshalling")
+	event := &es.Event{
+		Type:          item.Type,
+		Timestamp:     item.Timestamp,
+		AggregateID:   item.AggregateID,
+		AggregateType: item.AggregateType,
+		Version:       item.Version,
+		Data:          data,
+		Metadata:      item.Metadata,
+		Tenant:        item.Tenant,
+	}
+	if c.pii != nil {
+		if err := c.pii.Decrypt(ctx, event); err != nil {
+			logger.Error("Issue decrypting",
+				"error", err,
+				"type", item.Type,
+			)
 			return nil, err
 		}
+	}
+	return event, nil
+}
 
-		events = append(events, &es.Event{
-			Type:          item.Type,
-			Timestamp:     item.Timestamp,
-			AggregateID:   item.AggregateID,
-			AggregateType: item.AggregateType,
-			Version:       item.Version,
-			Data:          data,
-		})
+// eventStream reads the archived events first when there are any, first is
+// the live event that was read to find out
+type eventStream struct {
+	store   *store
+	logger  es.Logger
+	cursors []*mongo.Cursor
+	first   *es.Event
+	event   *es.Event
+	err     error
+}
+
+func (s *eventStream) Next(ctx context.Context) bool {
+	for s.err == nil && len(s.cursors) > 0 {
+		if len(s.cursors) == 1 && s.first != nil {
+			s.event, s.first = s.first, nil
+			return true
+		}
+
+		cur := s.cursors[0]
+		if cur.Next(ctx) {
+			s.event, s.err = s.store.decodeEvent(ctx, cur, s.logger)
+			return s.err == nil
+		}
+		s.err = cur.Err()
+		cur.Close(ctx)
+		s.cursors = s.cursors[1:]
+	}
+	return false
+}
+
+func (s *eventStream) Event() *es.Event {
+	return s.event
+}
+
+func (s *eventStream) Err() error {
+	return s.err
+}
+
+func (s *eventStream) Close(ctx context.Context) error {
+	var err error
+	for _, cur := range s.cursors {
+		if cerr := cur.Close(ctx); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	s.cursors = nil
+	return err
+}
+
+// ArchiveEvents moves the events of a stream below a version to the archive
+// collection. They are copied before being deleted so an interrupted run can
+// be repeated, the last event always stays.
+func (c *store) ArchiveEvents(ctx context.Context, id string, typeName string, beforeVersion int) (int, error) {
+	logger := es.LoggerFromContext(ctx, c.logger).With(
+		"aggregateID", id,
+		"aggregateType", typeName,
+		"beforeVersion", beforeVersion,
+	)
+
+	filter := bson.M{
+		"tenant":         tenantOf(ctx),
+		"aggregate_id":   id,
+		"aggregate_type": typeName,
+	}
+	aggregate := &AggregateDB{}
+	if err := c.database(ctx).
+		Collection(AggregatesCollection).
+		FindOne(ctx, filter).
+		Decode(aggregate); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if beforeVersion > aggregate.Version {
+		beforeVersion = aggregate.Version
+	}
+	filter["version"] = bson.M{"$lt": beforeVersion}
+
+	cur, err := c.database(ctx).
+		Collection(EventsCollection).
+		Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	archive := c.database(ctx).Collection(ArchiveCollection)
+	writes := []mongo.WriteModel{}
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err := archive.BulkWrite(ctx, writes)
+		writes = writes[:0]
+		return err
+	}
+	for cur.Next(ctx) {
+		var item EventDB
+		if err := cur.Decode(&item); err != nil {
+			return 0, err
+		}
+
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{
+				"tenant":         tenantOf(ctx),
+				"aggregate_id":   item.AggregateID,
+				"aggregate_type": item.AggregateType,
+				"version":        item.Version,
+			}).
+			SetReplacement(item).
+			SetUpsert(true))
+		if len(writes) == archiveBatchSize {
+			if err := flush(); err != nil {
+				logger.Error("Could not archive events", "error", err)
+				return 0, err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return 0, err
+	}
+	if err := flush(); err != nil {
+		logger.Error("Could not archive events", "error", err)
+		return 0, err
+	}
+
+	res, err := c.database(ctx).
+		Collection(EventsCollection).
+		DeleteMany(ctx, filter)
+	if err != nil {
+		logger.Error("Could not delete archived events", "error", err)
+		return 0, err
 	}
 
-	logger.Debug().Interface("events", events).Msg("What are the events")
-	return events, nil
+	logger.Debug("Events archived", "archived", res.DeletedCount)
+	return int(res.DeletedCount), nil
 }
 
 // Save the events ensuring the current version
@@ -215,17 +462,35 @@ func (c *store) SaveSnapshot(ctx context.Context, revision string, aggregate es.
 	aggregateType := aggregate.GetTypeName()
 
 	filter := bson.M{
+		"tenant":         tenantOf(ctx),
 		"aggregate_id":   aggregateID,
 		"aggregate_type": aggregateType,
 		"revision":       revision,
 	}
-	update := bson.M{"$set": aggregate}
+
+	raw, err := bson.Marshal(aggregate)
+	if err != nil {
+		return err
+	}
+	doc := bson.M{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+
+	// keep the version at the top so snapshots can be listed without
+	// knowing how the aggregate is laid out
+	if sourced, ok := aggregate.(es.AggregateSourced); ok {
+		if _, ok := doc["version"]; !ok {
+			doc["version"] = sourced.GetVersion()
+		}
+	}
+	update := bson.M{"$set": doc}
 
 	opts := options.
 		Update().
 		SetUpsert(true)
 
-	_, err := c.db.
+	_, err = c.database(ctx).
 		Collection(SnapshotsCollection).
 		UpdateOne(ctx, filter, update, opts)
 
@@ -238,12 +503,13 @@ func (c *store) LoadSnapshot(ctx context.Context, revision string, aggregate es.
 	aggregateType := aggregate.GetTypeName()
 
 	filter := bson.M{
+		"tenant":         tenantOf(ctx),
 		"aggregate_id":   aggregateID,
 		"aggregate_type": aggregateType,
 		"revision":       revision,
 	}
 
-	if err := c.db.
+	if err := c.database(ctx).
 		Collection(SnapshotsCollection).
 		FindOne(ctx, filter).
 		Decode(aggregate); err != nil && err != mongo.ErrNoDocuments {
@@ -253,34 +519,118 @@ func (c *store) LoadSnapshot(ctx context.Context, revision string, aggregate es.
 	return nil
 }
 
+// SnapshotRevisions returns every revision that has snapshots
+func (c *store) SnapshotRevisions(ctx context.Context) ([]string, error) {
+	values, err := c.database(ctx).
+		Collection(SnapshotsCollection).
+		Distinct(ctx, "revision", bson.M{"tenant": tenantOf(ctx)})
+	if err != nil {
+		return nil, err
+	}
+
+	return toStrings(values), nil
+}
+
+// ListSnapshots returns the snapshots stored for a revision
+func (c *store) ListSnapshots(ctx context.Context, revision string) ([]*es.SnapshotRecord, error) {
+	filter := bson.M{
+		"tenant":   tenantOf(ctx),
+		"revision": revision,
+	}
+	opts := options.
+		Find().
+		SetProjection(bson.M{
+			"aggregate_id":   1,
+			"aggregate_type": 1,
+			"revision":       1,
+			"version":        1,
+		})
+
+	cur, err := c.database(ctx).
+		Collection(SnapshotsCollection).
+		Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	records := []*es.SnapshotRecord{}
+	for cur.Next(ctx) {
+		var item SnapshotDB
+		if err := cur.Decode(&item); err != nil {
+			return nil, err
+		}
+
+		records = append(records, &es.SnapshotRecord{
+			AggregateID:   item.AggregateID,
+			AggregateType: item.AggregateType,
+			Revision:      item.Revision,
+			Version:       item.Version,
+		})
+	}
+	return records, cur.Err()
+}
+
+// DeleteSnapshots removes the snapshots stored for a revision
+func (c *store) DeleteSnapshots(ctx context.Context, revision string) error {
+	filter := bson.M{
+		"tenant":   tenantOf(ctx),
+		"revision": revision,
+	}
+
+	res, err := c.database(ctx).
+		Collection(SnapshotsCollection).
+		DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	es.LoggerFromContext(ctx, c.logger).Debug("Snapshots deleted",
+		"revision", revision,
+		"deleted", res.DeletedCount,
+	)
+	return nil
+}
+
 // Save the events ensuring the current version
 func (c *store) SaveAggregate(ctx context.Context, aggregate es.Aggregate) error {
 	id := aggregate.GetID()
 	typeName := aggregate.GetTypeName()
 
-	selector := bson.M{"id": id}
+	selector := bson.M{"id": id, "tenant": tenantOf(ctx)}
 	update := bson.M{"$set": aggregate}
 
 	opts := options.
 		Update().
 		SetUpsert(true)
 
-	_, err := c.db.
+	_, err := c.database(ctx).
 		Collection(typeName).
 		UpdateOne(ctx, selector, update, opts)
 
 	return err
 }
 
+// DeleteAggregate removes the projection of a deleted aggregate
+func (c *store) DeleteAggregate(ctx context.Context, aggregate es.Aggregate) error {
+	selector := bson.M{"id": aggregate.GetID(), "tenant": tenantOf(ctx)}
+
+	_, err := c.database(ctx).
+		Collection(aggregate.GetTypeName()).
+		DeleteOne(ctx, selector)
+	return err
+}
+
 // Load the events from the data store
 func (c *store) LoadAggregate(ctx context.Context, aggregate es.Aggregate) error {
 	id := aggregate.GetID()
 	typeName := aggregate.GetTypeName()
 
 	query := bson.M{
-		"id": id,
+		"tenant": tenantOf(ctx),
+		"id":     id,
 	}
-	if err := c.db.
+	if err := c.database(ctx).
 		Collection(typeName).
 		FindOne(ctx, query).
 		Decode(aggregate); err != nil && err != mongo.ErrNoDocuments {
@@ -290,6 +640,33 @@ func (c *store) LoadAggregate(ctx context.Context, aggregate es.Aggregate) error
 	return nil
 }
 
+// AggregateTypes returns every aggregate type that has events
+func (c *store) AggregateTypes(ctx context.Context) ([]string, error) {
+	values, err := c.database(ctx).
+		Collection(AggregatesCollection).
+		Distinct(ctx, "aggregate_type", bson.M{"tenant": tenantOf(ctx)})
+	if err != nil {
+		return nil, err
+	}
+	return toStrings(values), nil
+}
+
+// AggregateIDs returns the ID of every aggregate of a type that has events
+func (c *store) AggregateIDs(ctx context.Context, typeName string) ([]string, error) {
+	filter := bson.M{
+		"tenant":         tenantOf(ctx),
+		"aggregate_type": typeName,
+	}
+
+	values, err := c.database(ctx).
+		Collection(AggregatesCollection).
+		Distinct(ctx, "aggregate_id", filter)
+	if err != nil {
+		return nil, err
+	}
+	return toStrings(values), nil
+}
+
 // Close underlying connection
 func (c *store) Close() error {
 	if c.db != nil {
@@ -299,3 +676,13 @@ func (c *store) Close() error {
 	}
 	return nil
 }
+
+func toStrings(values []interface{}) []string {
+	out := []string{}
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
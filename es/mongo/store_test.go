@@ -0,0 +1,84 @@
+//go:build mongo
+// +build mongo
+
+package mongo
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/contextgg/go-es/es"
+	"github.com/contextgg/go-es/es/storetest"
+)
+
+// Run with `go test -tags mongo ./es/mongo`, MONGO_URI defaults to a local server
+func TestStore(t *testing.T) {
+	uri := os.Getenv("MONGO_URI")
+	if len(uri) == 0 {
+		uri = "mongodb://localhost:27017"
+	}
+
+	storetest.Run(t, func(r es.EventRegistry) (es.DataStore, error) {
+		db, err := Create(uri, "go-es-storetest", "", "", false)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Drop(context.Background()); err != nil {
+			return nil, err
+		}
+		// small batches so streams span several of them
+		return NewStore(db, r.Get, WithBatchSize(2))
+	})
+}
+
+func TestKeyStore(t *testing.T) {
+	uri := os.Getenv("MONGO_URI")
+	if len(uri) == 0 {
+		uri = "mongodb://localhost:27017"
+	}
+
+	ctx := context.Background()
+	// the keys live apart from the events, without their indexes
+	db, err := Create(uri, "go-es-keystore", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Drop(ctx)
+
+	keys := NewKeyStore(db)
+
+	cursor, err := db.Collection(KeysCollection).Indexes().List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indexes []bson.M
+	if err := cursor.All(ctx, &indexes); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, index := range indexes {
+		found = found || index["name"] == "keys.tenant.subject"
+	}
+	if !found {
+		t.Errorf("expected the keys index, got %v", indexes)
+	}
+
+	key, err := keys.CreateKey(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := keys.CreateKey(ctx, "bob")
+	if err != nil || string(again) != string(key) {
+		t.Errorf("expected the same key, got %v", err)
+	}
+
+	if err := keys.DeleteKey(ctx, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.GetKey(ctx, "bob"); err != es.ErrKeyNotFound {
+		t.Errorf("expected %v, got %v", es.ErrKeyNotFound, err)
+	}
+}
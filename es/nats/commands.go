@@ -0,0 +1,243 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/contextgg/go-es/es"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// DefaultCommandTimeout is used when the context of a command has no deadline
+const DefaultCommandTimeout = 10 * time.Second
+
+// error codes carried in a CommandReply
+const (
+	codeNotFound        = "not_found"
+	codeVersionMismatch = "version_mismatch"
+	codeInvalid         = "invalid"
+	codeExists          = "aggregate_exists"
+	codeMissing         = "aggregate_not_found"
+	codeDeleted         = "aggregate_deleted"
+)
+
+// CommandTimeout sets how long to wait for a reply when the context of a
+// command has no deadline
+func CommandTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.commandTimeout = d
+	}
+}
+
+// QueueGroup sets the queue group used by ServeCommands so only one instance
+// of a service handles each command, it defaults to {namespace}.commands
+func QueueGroup(name string) Option {
+	return func(c *Client) {
+		c.queueGroup = name
+	}
+}
+
+// CommandRequest is a command on the wire
+type CommandRequest struct {
+	Command  json.RawMessage   `json:"command"`
+	Deadline *time.Time        `json:"deadline,omitempty"`
+	Trace    map[string]string `json:"trace,omitempty"`
+	Tenant   string            `json:"tenant,omitempty"`
+}
+
+// CommandReply is the answer to a CommandRequest, an empty Error means the
+// command was handled
+type CommandReply struct {
+	AggregateID string `json:"aggregate_id,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Code        string `json:"code,omitempty"`
+}
+
+// RemoteError is a command failure reported by the owning service, it
+// unwraps to the es error it was created from when the caller can act on it
+type RemoteError struct {
+	Code    string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the es error matching the code
+func (e *RemoteError) Unwrap() error {
+	switch e.Code {
+	case codeNotFound:
+		return es.ErrCommandNotFound
+	case codeVersionMismatch:
+		return es.ErrVersionMismatch
+	case codeExists:
+		return es.ErrAggregateExists
+	case codeMissing:
+		return es.ErrAggregateNotFound
+	case codeDeleted:
+		return es.ErrAggregateDeleted
+	}
+	return nil
+}
+
+// CommandSubject is where the command is sent
+func CommandSubject(namespace string, name string) string {
+	return namespace + ".commands." + name
+}
+
+// HandleCommand sends the command to the service owning it and waits for the
+// reply, so a Client can be wired with builder.WireCommandHandler
+func (c *Client) HandleCommand(ctx context.Context, cmd es.Command) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.commandTimeout)
+		defer cancel()
+	}
+
+	data, err := encodeCommand(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	_, name := es.GetTypeName(cmd)
+	subj := CommandSubject(c.namespace, name)
+	msg, err := c.conn.Conn.RequestWithContext(ctx, subj, data)
+	if err != nil {
+		es.LoggerFromContext(ctx, c.logger).Error("Could not send command",
+			"error", err,
+			"subj", subj,
+			"aggregate_id", cmd.GetAggregateID(),
+		)
+		return err
+	}
+	return decodeReply(msg.Data)
+}
+
+// ServeCommands subscribes to the subjects of the commands and dispatches
+// them through the bus. Commands of the same type are handled one at a time.
+func (c *Client) ServeCommands(bus es.CommandBus, commands ...es.Command) error {
+	for _, cmd := range commands {
+		_, name := es.GetTypeName(cmd)
+		subj := CommandSubject(c.namespace, name)
+
+		sub, err := c.conn.Conn.QueueSubscribe(subj, c.queueGroup, func(msg *nats.Msg) {
+			reply := handleRequest(bus, name, msg.Data, c.logger)
+			if err := msg.Respond(reply); err != nil {
+				c.logger.Error("Could not reply to command",
+					"error", err,
+					"subj", subj,
+				)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		c.subs = append(c.subs, sub)
+
+		c.logger.Debug("Serving command via Nats", "subj", subj)
+	}
+	return nil
+}
+
+func encodeCommand(ctx context.Context, cmd es.Command) ([]byte, error) {
+	raw, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &CommandRequest{
+		Command: raw,
+		Trace:   make(map[string]string),
+		Tenant:  es.TenantFromContext(ctx),
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Deadline = &deadline
+	}
+	es.InjectTrace(ctx, propagation.MapCarrier(req.Trace))
+	return json.Marshal(req)
+}
+
+func decodeReply(data []byte) error {
+	reply := &CommandReply{}
+	if err := json.Unmarshal(data, reply); err != nil {
+		return err
+	}
+	if len(reply.Error) > 0 {
+		return &RemoteError{
+			Code:    reply.Code,
+			Message: reply.Error,
+		}
+	}
+	return nil
+}
+
+// handleRequest decodes and dispatches one command, the returned bytes are
+// the CommandReply
+func handleRequest(bus es.CommandBus, name string, data []byte, logger es.Logger) []byte {
+	reply := &CommandReply{}
+	if err := dispatch(bus, name, data, reply, logger); err != nil {
+		reply.Error = err.Error()
+		switch {
+		case errors.Is(err, es.ErrCommandNotFound):
+			reply.Code = codeNotFound
+		case errors.Is(err, es.ErrVersionMismatch):
+			reply.Code = codeVersionMismatch
+		case errors.Is(err, errInvalidRequest):
+			reply.Code = codeInvalid
+		case errors.Is(err, es.ErrAggregateExists):
+			reply.Code = codeExists
+		case errors.Is(err, es.ErrAggregateNotFound):
+			reply.Code = codeMissing
+		case errors.Is(err, es.ErrAggregateDeleted):
+			reply.Code = codeDeleted
+		}
+	}
+
+	out, _ := json.Marshal(reply)
+	return out
+}
+
+var errInvalidRequest = errors.New("Invalid command request")
+
+func dispatch(bus es.CommandBus, name string, data []byte, reply *CommandReply, logger es.Logger) error {
+	req := &CommandRequest{}
+	if err := json.Unmarshal(data, req); err != nil {
+		return errInvalidRequest
+	}
+
+	cmd, err := bus.NewCommand(name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(req.Command, cmd); err != nil {
+		return errInvalidRequest
+	}
+
+	ctx := es.ExtractTrace(context.Background(), propagation.MapCarrier(req.Trace))
+	if len(req.Tenant) > 0 {
+		ctx = es.WithTenant(ctx, req.Tenant)
+	}
+	if req.Deadline != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, *req.Deadline)
+		defer cancel()
+	}
+
+	if err := bus.HandleCommand(ctx, cmd); err != nil {
+		logger.Error("Could not handle remote command",
+			"error", err,
+			"command", name,
+			"aggregate_id", cmd.GetAggregateID(),
+		)
+		return err
+	}
+
+	reply.AggregateID = cmd.GetAggregateID()
+	return nil
+}
@@ -0,0 +1,116 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/contextgg/go-es/es"
+)
+
+type TryLoginCommand struct {
+	es.BaseCommand
+
+	Username string `json:"username"`
+}
+
+func TestCommandRoundTrip(t *testing.T) {
+	data := []struct {
+		name string
+		err  error
+		is   error
+	}{
+		{"handled", nil, nil},
+		{"version conflict", es.ErrVersionMismatch, es.ErrVersionMismatch},
+		{"other error", errors.New("boom"), nil},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			var got *TryLoginCommand
+			var deadline time.Time
+			bus := es.NewCommandBus()
+			bus.SetHandler(es.CommandHandlerFunc(func(ctx context.Context, cmd es.Command) error {
+				got = cmd.(*TryLoginCommand)
+				deadline, _ = ctx.Deadline()
+				return d.err
+			}), &TryLoginCommand{})
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			want, _ := ctx.Deadline()
+
+			req, err := encodeCommand(ctx, &TryLoginCommand{
+				BaseCommand: es.BaseCommand{AggregateID: "42"},
+				Username:    "bob",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = decodeReply(handleRequest(bus, "TryLoginCommand", req, es.NopLogger()))
+			if got == nil || got.AggregateID != "42" || got.Username != "bob" {
+				t.Errorf("got command %+v", got)
+			}
+			if !deadline.Equal(want) {
+				t.Errorf("expected deadline %v, got %v", want, deadline)
+			}
+
+			switch {
+			case d.err == nil && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case d.err != nil && (err == nil || err.Error() != d.err.Error()):
+				t.Errorf("expected error %v, got %v", d.err, err)
+			case d.is != nil && !errors.Is(err, d.is):
+				t.Errorf("expected %v to be %v", err, d.is)
+			}
+		})
+	}
+}
+
+func TestCommandNotFound(t *testing.T) {
+	req, err := encodeCommand(context.Background(), &TryLoginCommand{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = decodeReply(handleRequest(es.NewCommandBus(), "TryLoginCommand", req, es.NopLogger()))
+	if !errors.Is(err, es.ErrCommandNotFound) {
+		t.Errorf("expected %v, got %v", es.ErrCommandNotFound, err)
+	}
+}
+
+func TestCommandTenant(t *testing.T) {
+	var tenant string
+	bus := es.NewCommandBus()
+	bus.SetHandler(es.CommandHandlerFunc(func(ctx context.Context, cmd es.Command) error {
+		tenant = es.TenantFromContext(ctx)
+		return nil
+	}), &TryLoginCommand{})
+
+	req, err := encodeCommand(es.WithTenant(context.Background(), "acme"), &TryLoginCommand{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decodeReply(handleRequest(bus, "TryLoginCommand", req, es.NopLogger())); err != nil {
+		t.Fatal(err)
+	}
+	if tenant != "acme" {
+		t.Errorf("got tenant %q, want acme", tenant)
+	}
+
+	data := map[string]string{
+		"acme":  "auth.acme.LoggedIn",
+		"a.b":   "auth.a%2Eb.LoggedIn",
+		"*":     "auth.%2A.LoggedIn",
+		">":     "auth.%3E.LoggedIn",
+		"a%2Eb": "auth.a%252Eb.LoggedIn",
+		"a b/c": "auth.a%20b%2Fc.LoggedIn",
+	}
+	for tenant, want := range data {
+		if subj := EventSubject("auth", tenant, "LoggedIn"); subj != want {
+			t.Errorf("got subject %s for %q, want %s", subj, tenant, want)
+		}
+	}
+}
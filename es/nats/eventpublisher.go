@@ -3,50 +3,55 @@ package nats
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/contextgg/go-es/es"
 
 	nats "github.com/nats-io/nats.go"
-	"github.com/rs/zerolog/log"
 )
 
+// Option so we can configure the client
+type Option = func(*Client)
+
+// WithLogger sets the logger used when the context has none
+func WithLogger(logger es.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
 // Client nats
 type Client struct {
-	namespace string
-	conn      *nats.EncodedConn
+	namespace      string
+	conn           *nats.EncodedConn
+	logger         es.Logger
+	commandTimeout time.Duration
+	queueGroup     string
+	subs           []*nats.Subscription
 }
 
-func natsLogger(msg string) nats.ConnHandler {
+func natsLogger(logger es.Logger, msg string) nats.ConnHandler {
 	return func(conn *nats.Conn) {
-		log.
-			Debug().
-			Str("connected_url", conn.ConnectedUrl()).
-			Msg(msg)
+		logger.Debug(msg, "connected_url", conn.ConnectedUrl())
 	}
 }
 
-func retryConnect(uri string, max int) (*nats.Conn, error) {
-	log.
-		Debug().
-		Str("uri", uri).
-		Msg("Try connecting to Nats")
+func retryConnect(logger es.Logger, uri string, max int) (*nats.Conn, error) {
+	logger.Debug("Try connecting to Nats", "uri", uri)
 
 	count := 0
 	for count < max {
 		if count > 0 {
-			log.
-				Debug().
-				Str("uri", uri).
-				Msg("Sleep while we wait for Nats server")
+			logger.Debug("Sleep while we wait for Nats server", "uri", uri)
 			time.Sleep(3 * time.Second)
 		}
 
 		client, err := nats.Connect(uri,
 			nats.Name("es-publisher"),
 			nats.MaxReconnects(-1),
-			nats.ReconnectHandler(natsLogger("Nats reconnect handler")),
-			nats.DisconnectHandler(natsLogger("Nats disconnect handler")),
+			nats.ReconnectHandler(natsLogger(logger, "Nats reconnect handler")),
+			nats.DisconnectHandler(natsLogger(logger, "Nats disconnect handler")),
 		)
 		if client != nil && err == nil {
 			return client, nil
@@ -58,15 +63,30 @@ func retryConnect(uri string, max int) (*nats.Conn, error) {
 }
 
 // NewClient returns the basic client to access to nats
-func NewClient(uri string, namespace string) (es.EventPublisher, error) {
-	conn, err := retryConnect(uri, 5)
+func NewClient(uri string, namespace string, opts ...Option) (es.EventPublisher, error) {
+	return Dial(uri, namespace, opts...)
+}
+
+// Dial connects to nats, the client publishes events, sends commands to
+// other services and serves the commands of this one
+func Dial(uri string, namespace string, opts ...Option) (*Client, error) {
+	c := &Client{
+		namespace:      namespace,
+		logger:         es.DefaultLogger(),
+		commandTimeout: DefaultCommandTimeout,
+		queueGroup:     namespace + ".commands",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	conn, err := retryConnect(c.logger, uri, 5)
 	if err != nil {
-		log.
-			Error().
-			Err(err).
-			Str("uri", uri).
-			Str("namespace", namespace).
-			Msg("Could not setup Nats client")
+		c.logger.Error("Could not setup Nats client",
+			"error", err,
+			"uri", uri,
+			"namespace", namespace,
+		)
 		return nil, err
 	}
 
@@ -75,49 +95,75 @@ func NewClient(uri string, namespace string) (es.EventPublisher, error) {
 	// setup the encoded connection here
 	ec, err := nats.NewEncodedConn(conn, nats.JSON_ENCODER)
 	if err != nil {
-		log.
-			Error().
-			Err(err).
-			Str("uri", uri).
-			Str("namespace", namespace).
-			Msg("Could not create encoded connection")
+		c.logger.Error("Could not create encoded connection",
+			"error", err,
+			"uri", uri,
+			"namespace", namespace,
+		)
 		return nil, err
 	}
 
-	return &Client{
-		namespace,
-		ec,
-	}, nil
+	c.conn = ec
+	return c, nil
+}
+
+// EventSubject is where an event is published, {namespace}.{tenant}.{type}
+// or {namespace}.{type} without a tenant. The tenant is escaped with
+// SubjectToken.
+func EventSubject(namespace string, tenant string, eventType string) string {
+	if len(tenant) > 0 {
+		return namespace + "." + SubjectToken(tenant) + "." + eventType
+	}
+	return namespace + "." + eventType
+}
+
+// SubjectToken percent-encodes everything but letters, digits, '-' and '_'
+// so the value is a single subject token and never a wildcard
+func SubjectToken(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
 }
 
 // PublishEvent via nats
 func (c *Client) PublishEvent(ctx context.Context, event *es.Event) error {
-	subj := c.namespace + "." + event.Type
+	logger := es.LoggerFromContext(ctx, c.logger)
+
+	subj := EventSubject(c.namespace, event.Tenant, event.Type)
 	if err := c.conn.Publish(subj, event); err != nil {
-		log.
-			Error().
-			Err(err).
-			Str("subj", subj).
-			Msg("Could not publish event")
+		logger.Error("Could not publish event",
+			"error", err,
+			"subj", subj,
+		)
 		return err
 	}
 
-	log.
-		Debug().
-		Str("subj", subj).
-		Str("event_type", event.Type).
-		Str("event_aggregate_id", event.AggregateID).
-		Str("event_aggregate_type", event.AggregateType).
-		Msg("Event Published via Nats")
+	logger.Debug("Event Published via Nats",
+		"subj", subj,
+		"event_type", event.Type,
+		"event_aggregate_id", event.AggregateID,
+		"event_aggregate_type", event.AggregateType,
+	)
 	return nil
 }
 
 // Close underlying connection
 func (c *Client) Close() {
+	for _, sub := range c.subs {
+		sub.Unsubscribe()
+	}
+	c.subs = nil
+
 	if c.conn != nil {
-		log.
-			Debug().
-			Msg("Closing the Nats connection")
+		c.logger.Debug("Closing the Nats connection")
 		c.conn.Close()
 	}
 }
@@ -0,0 +1,282 @@
+package es
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrKeyNotFound when a subject has no key, it was never created or it was
+	// deleted to erase the subject
+	ErrKeyNotFound = errors.New("Key not found")
+	// ErrInvalidCiphertext when an encrypted field can't be decoded
+	ErrInvalidCiphertext = errors.New("Invalid ciphertext")
+)
+
+// piiPrefix marks a field value as encrypted
+const piiPrefix = "pii:"
+
+// KeyStore holds a data key per subject, deleting the key of a subject makes
+// every field encrypted for it unreadable
+type KeyStore interface {
+	// GetKey returns ErrKeyNotFound when the subject has no key
+	GetKey(ctx context.Context, subject string) ([]byte, error)
+	// CreateKey returns the key of the subject, creating it when needed
+	CreateKey(ctx context.Context, subject string) ([]byte, error)
+	DeleteKey(ctx context.Context, subject string) error
+}
+
+// NewMemoryKeyStore create a KeyStore for tests
+func NewMemoryKeyStore() KeyStore {
+	return &memoryKeyStore{
+		keys: make(map[string][]byte),
+	}
+}
+
+type memoryKeyStore struct {
+	sync.RWMutex
+	keys map[string][]byte
+}
+
+func (s *memoryKeyStore) GetKey(ctx context.Context, subject string) ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	key, ok := s.keys[tenantSubject(ctx, subject)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *memoryKeyStore) CreateKey(ctx context.Context, subject string) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if key, ok := s.keys[tenantSubject(ctx, subject)]; ok {
+		return key, nil
+	}
+	key, err := NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	s.keys[tenantSubject(ctx, subject)] = key
+	return key, nil
+}
+
+func (s *memoryKeyStore) DeleteKey(ctx context.Context, subject string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.keys, tenantSubject(ctx, subject))
+	return nil
+}
+
+// subjects of different tenants never share a key
+func tenantSubject(ctx context.Context, subject string) string {
+	return TenantFromContext(ctx) + "/" + subject
+}
+
+// NewDataKey returns a random AES-256 key
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// PII encrypts the string fields of event payloads tagged `es:"pii"` with the
+// key of their subject. The subject is the field tagged `es:"subject"`, or
+// the aggregate ID when there is none. Datastores use it so payloads are only
+// encrypted in the database.
+type PII struct {
+	keys   KeyStore
+	fields sync.Map
+}
+
+// NewPII creates the field encryption on top of a key store
+func NewPII(keys KeyStore) *PII {
+	return &PII{
+		keys: keys,
+	}
+}
+
+type piiFields struct {
+	pii     [][]int
+	subject []int
+}
+
+// fieldsFor finds the tagged fields of a struct type, nested structs are
+// searched too
+func (p *PII) fieldsFor(t reflect.Type) *piiFields {
+	if f, ok := p.fields.Load(t); ok {
+		return f.(*piiFields)
+	}
+
+	f := &piiFields{}
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if len(field.PkgPath) > 0 {
+				continue
+			}
+			path := append(append([]int{}, index...), i)
+
+			switch {
+			case field.Type.Kind() == reflect.Struct:
+				walk(field.Type, path)
+			case field.Type.Kind() != reflect.String:
+			case hasTag(field, "pii"):
+				f.pii = append(f.pii, path)
+			case hasTag(field, "subject") && f.subject == nil:
+				f.subject = path
+			}
+		}
+	}
+	walk(t, nil)
+
+	p.fields.Store(t, f)
+	return f
+}
+
+func hasTag(field reflect.StructField, name string) bool {
+	for _, tag := range strings.Split(field.Tag.Get("es"), ",") {
+		if tag == name {
+			return true
+		}
+	}
+	return false
+}
+
+// structOf returns the struct behind data
+func structOf(data interface{}) (reflect.Value, bool) {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	return v.Elem(), true
+}
+
+func (p *PII) subject(evt *Event, v reflect.Value, fields *piiFields) string {
+	if fields.subject != nil {
+		if subject := v.FieldByIndex(fields.subject).String(); len(subject) > 0 {
+			return subject
+		}
+	}
+	return evt.AggregateID
+}
+
+// Encrypt returns a copy of the event data with its personal fields
+// encrypted, the event itself is left untouched
+func (p *PII) Encrypt(ctx context.Context, evt *Event) (interface{}, error) {
+	v, ok := structOf(evt.Data)
+	if !ok {
+		return evt.Data, nil
+	}
+	fields := p.fieldsFor(v.Type())
+	if len(fields.pii) == 0 {
+		return evt.Data, nil
+	}
+
+	subject := p.subject(evt, v, fields)
+	key, err := p.keys.CreateKey(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := reflect.New(v.Type())
+	out.Elem().Set(v)
+	for _, index := range fields.pii {
+		field := out.Elem().FieldByIndex(index)
+		if len(field.String()) == 0 {
+			continue
+		}
+
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+		sealed := gcm.Seal(nonce, nonce, []byte(field.String()), []byte(subject))
+		field.SetString(piiPrefix + base64.RawStdEncoding.EncodeToString(sealed))
+	}
+	return out.Interface(), nil
+}
+
+// Decrypt restores the personal fields of the event data in place. When the
+// key of the subject was deleted the fields are left empty, so the stream can
+// still be replayed.
+func (p *PII) Decrypt(ctx context.Context, evt *Event) error {
+	v, ok := structOf(evt.Data)
+	if !ok {
+		return nil
+	}
+	fields := p.fieldsFor(v.Type())
+	if len(fields.pii) == 0 {
+		return nil
+	}
+
+	subject := p.subject(evt, v, fields)
+	var gcm cipher.AEAD
+	for _, index := range fields.pii {
+		field := v.FieldByIndex(index)
+		if !strings.HasPrefix(field.String(), piiPrefix) {
+			continue
+		}
+
+		if gcm == nil {
+			key, err := p.keys.GetKey(ctx, subject)
+			if errors.Is(err, ErrKeyNotFound) {
+				clearPII(v, fields)
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if gcm, err = newGCM(key); err != nil {
+				return err
+			}
+		}
+
+		sealed, err := base64.RawStdEncoding.DecodeString(field.String()[len(piiPrefix):])
+		if err != nil || len(sealed) < gcm.NonceSize() {
+			return ErrInvalidCiphertext
+		}
+		plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(subject))
+		if err != nil {
+			return ErrInvalidCiphertext
+		}
+		field.SetString(string(plain))
+	}
+	return nil
+}
+
+// clearPII empties the encrypted fields of a shredded subject
+func clearPII(v reflect.Value, fields *piiFields) {
+	for _, index := range fields.pii {
+		if field := v.FieldByIndex(index); strings.HasPrefix(field.String(), piiPrefix) {
+			field.SetString("")
+		}
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
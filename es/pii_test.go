@@ -0,0 +1,95 @@
+package es
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type Address struct {
+	Street string `es:"pii"`
+}
+
+type SignedUp struct {
+	UserID   string `es:"subject"`
+	Username string `es:"pii"`
+	Plan     string
+	Address  Address
+}
+
+func TestPIIRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	keys := NewMemoryKeyStore()
+	pii := NewPII(keys)
+
+	data := &SignedUp{UserID: "u1", Username: "bob", Plan: "pro", Address: Address{"Main St"}}
+	evt := &Event{AggregateID: "a1", Data: data}
+
+	encrypted, err := pii.Encrypt(ctx, evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Username != "bob" || data.Address.Street != "Main St" {
+		t.Errorf("the event was changed %+v", data)
+	}
+
+	stored := encrypted.(*SignedUp)
+	if !strings.HasPrefix(stored.Username, piiPrefix) || !strings.HasPrefix(stored.Address.Street, piiPrefix) {
+		t.Errorf("expected encrypted fields, got %+v", stored)
+	}
+	if stored.Plan != "pro" || stored.UserID != "u1" {
+		t.Errorf("expected plain fields, got %+v", stored)
+	}
+	if _, err := keys.GetKey(ctx, "u1"); err != nil {
+		t.Errorf("expected a key for the subject field, got %v", err)
+	}
+
+	loaded := &Event{AggregateID: "a1", Data: stored}
+	if err := pii.Decrypt(ctx, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Username != "bob" || stored.Address.Street != "Main St" {
+		t.Errorf("got %+v", stored)
+	}
+}
+
+func TestPIIShredded(t *testing.T) {
+	ctx := context.Background()
+	keys := NewMemoryKeyStore()
+	pii := NewPII(keys)
+
+	evt := &Event{AggregateID: "a1", Data: &SignedUp{UserID: "u1", Username: "bob", Plan: "pro"}}
+	encrypted, err := pii.Encrypt(ctx, evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.DeleteKey(ctx, "u1"); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := encrypted.(*SignedUp)
+	if err := pii.Decrypt(ctx, &Event{AggregateID: "a1", Data: stored}); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Username != "" || stored.Plan != "pro" {
+		t.Errorf("got %+v", stored)
+	}
+}
+
+func TestPIIWrongSubject(t *testing.T) {
+	ctx := context.Background()
+	keys := NewMemoryKeyStore()
+	pii := NewPII(keys)
+
+	encrypted, err := pii.Encrypt(ctx, &Event{AggregateID: "a1", Data: &Address{"Main St"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the ciphertext is bound to its subject
+	key, _ := keys.GetKey(ctx, "a1")
+	keys.(*memoryKeyStore).keys[tenantSubject(ctx, "a2")] = key
+	if err := pii.Decrypt(ctx, &Event{AggregateID: "a2", Data: encrypted}); err != ErrInvalidCiphertext {
+		t.Errorf("expected %v, got %v", ErrInvalidCiphertext, err)
+	}
+}
@@ -0,0 +1,209 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ErrAggregateNotRouted when a BaseAggregateRouted was not created by
+// NewAggregateSourcedFactory or bound with RouteAggregate
+var ErrAggregateNotRouted = errors.New("Aggregate has no routes, create it with NewAggregateSourcedFactory")
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	commandType = reflect.TypeOf((*Command)(nil)).Elem()
+)
+
+// BaseAggregateRouted is an opt-in BaseAggregateSourced that routes
+// commands and events to methods named after their type:
+//
+//	func (a *Auth) HandleLogin(ctx context.Context, cmd *Login) error
+//	func (a *Auth) ApplyLoggedIn(e *LoggedIn)
+//
+// Handle methods take an optional context and return an error, Apply
+// methods take an optional context and may return an error. Commands and
+// events without a method fail with ErrUnhandledCommand and ErrUnhandledEvent.
+type BaseAggregateRouted struct {
+	BaseAggregateSourced `bson:",inline"`
+
+	self   reflect.Value
+	routes *routes
+}
+
+func (a *BaseAggregateRouted) bindRoutes(self AggregateSourced, r *routes) {
+	a.self = reflect.ValueOf(self)
+	a.routes = r
+}
+
+// HandleCommand calls the Handle method for the type of cmd
+func (a *BaseAggregateRouted) HandleCommand(ctx context.Context, cmd Command) error {
+	if a.routes == nil {
+		return ErrAggregateNotRouted
+	}
+	m, arg, ok := a.routes.commands.find(cmd)
+	if !ok {
+		_, name := GetTypeName(cmd)
+		return fmt.Errorf("%w: %s has no Handle%s", ErrUnhandledCommand, a.self.Type().Elem().Name(), name)
+	}
+	return m.call(ctx, a.self, arg)
+}
+
+// ApplyEvent calls the Apply method for the type of data
+func (a *BaseAggregateRouted) ApplyEvent(ctx context.Context, data interface{}) error {
+	if a.routes == nil {
+		return ErrAggregateNotRouted
+	}
+	m, arg, ok := a.routes.events.find(data)
+	if !ok {
+		_, name := GetTypeName(data)
+		return fmt.Errorf("%w: %s has no Apply%s", ErrUnhandledEvent, a.self.Type().Elem().Name(), name)
+	}
+	return m.call(ctx, a.self, arg)
+}
+
+// routedAggregate is implemented by aggregates embedding BaseAggregateRouted
+type routedAggregate interface {
+	bindRoutes(AggregateSourced, *routes)
+}
+
+// RouteAggregate binds an aggregate embedding BaseAggregateRouted to its
+// methods, aggregates created by NewAggregateSourcedFactory already are
+func RouteAggregate(aggregate AggregateSourced) error {
+	if !bindRoutes(aggregate) {
+		return ErrAggregateNotRouted
+	}
+	return nil
+}
+
+// bindRoutes binds a routed aggregate, stores copying a snapshot over an
+// aggregate copy the bindings too so it's called again after loading one
+func bindRoutes(aggregate AggregateSourced) bool {
+	r, ok := aggregate.(routedAggregate)
+	if !ok {
+		return false
+	}
+	r.bindRoutes(aggregate, routesFor(reflect.TypeOf(aggregate)))
+	return true
+}
+
+type routes struct {
+	commands methodTable
+	events   methodTable
+}
+
+var routeCache sync.Map
+
+// routesFor returns the dispatch table of an aggregate type, it is built
+// once per type
+func routesFor(t reflect.Type) *routes {
+	if r, ok := routeCache.Load(t); ok {
+		return r.(*routes)
+	}
+
+	r := &routes{
+		commands: methodTable{},
+		events:   methodTable{},
+	}
+	for i := 0; i < t.NumMethod(); i++ {
+		method := t.Method(i)
+		switch {
+		case strings.HasPrefix(method.Name, "Handle"):
+			if m, arg, ok := routedMethod(method, "Handle", true); ok && arg.Implements(commandType) {
+				r.commands[arg] = m
+			}
+		case strings.HasPrefix(method.Name, "Apply"):
+			if m, arg, ok := routedMethod(method, "Apply", false); ok {
+				r.events[arg] = m
+			}
+		}
+	}
+
+	actual, _ := routeCache.LoadOrStore(t, r)
+	return actual.(*routes)
+}
+
+// routedMethod checks method is prefix followed by the name of its
+// argument type, with an optional context before it and an optional
+// error result
+func routedMethod(method reflect.Method, prefix string, mustReturnError bool) (*routeMethod, reflect.Type, bool) {
+	// the receiver is the first input
+	in := method.Type.NumIn() - 1
+	if in < 1 || in > 2 {
+		return nil, nil, false
+	}
+	withContext := in == 2
+	if withContext && method.Type.In(1) != contextType {
+		return nil, nil, false
+	}
+	arg := method.Type.In(method.Type.NumIn() - 1)
+
+	switch method.Type.NumOut() {
+	case 0:
+		if mustReturnError {
+			return nil, nil, false
+		}
+	case 1:
+		if method.Type.Out(0) != errorType {
+			return nil, nil, false
+		}
+	default:
+		return nil, nil, false
+	}
+
+	named := arg
+	if named.Kind() == reflect.Ptr {
+		named = named.Elem()
+	}
+	if named.Kind() == reflect.Interface || method.Name != prefix+named.Name() {
+		return nil, nil, false
+	}
+
+	return &routeMethod{
+		index:       method.Index,
+		withContext: withContext,
+		withError:   method.Type.NumOut() == 1,
+	}, arg, true
+}
+
+type routeMethod struct {
+	index       int
+	withContext bool
+	withError   bool
+}
+
+func (m *routeMethod) call(ctx context.Context, self reflect.Value, arg reflect.Value) error {
+	args := []reflect.Value{arg}
+	if m.withContext {
+		args = []reflect.Value{reflect.ValueOf(&ctx).Elem(), arg}
+	}
+
+	out := self.Method(m.index).Call(args)
+	if m.withError && !out[0].IsNil() {
+		return out[0].Interface().(error)
+	}
+	return nil
+}
+
+type methodTable map[reflect.Type]*routeMethod
+
+// find the method for v, a pointer is dereferenced when the method takes a value
+func (t methodTable) find(v interface{}) (*routeMethod, reflect.Value, bool) {
+	val := reflect.ValueOf(v)
+	if !val.IsValid() {
+		return nil, val, false
+	}
+	if m, ok := t[val.Type()]; ok {
+		return m, val, true
+	}
+	if val.Kind() == reflect.Ptr && !val.IsNil() {
+		if m, ok := t[val.Type().Elem()]; ok {
+			return m, val.Elem(), true
+		}
+	}
+	return nil, val, false
+}
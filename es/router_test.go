@@ -0,0 +1,136 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type Rename struct {
+	BaseCommand
+
+	Name string
+}
+
+type Renamed struct {
+	Name string
+}
+
+type Archived struct{}
+
+// Profile routes by method name
+type Profile struct {
+	BaseAggregateRouted
+
+	Name     string
+	Archived bool
+}
+
+func (a *Profile) HandleRename(ctx context.Context, cmd *Rename) error {
+	if cmd.Name == "" {
+		return errors.New("Name is required")
+	}
+	a.StoreEvent(&Renamed{cmd.Name})
+	return nil
+}
+func (a *Profile) HandleTickCommand(cmd *TickCommand) error {
+	a.StoreEvent(&Archived{})
+	return nil
+}
+func (a *Profile) ApplyRenamed(e *Renamed) {
+	a.Name = e.Name
+}
+func (a *Profile) ApplyArchived(ctx context.Context, e Archived) error {
+	a.Archived = true
+	return nil
+}
+
+func newProfile(t *testing.T) *Profile {
+	factory := NewAggregateSourcedFactory(NewAggregateSourcedFunc(&Profile{}))
+	aggregate, err := factory("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aggregate.(*Profile)
+}
+
+func TestRoutedAggregate(t *testing.T) {
+	ctx := context.Background()
+	profile := newProfile(t)
+
+	if err := profile.HandleCommand(ctx, &Rename{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := profile.HandleCommand(ctx, &TickCommand{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range profile.Events() {
+		if err := profile.ApplyEvent(ctx, e.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if profile.Name != "bob" || !profile.Archived {
+		t.Errorf("got %+v", profile)
+	}
+
+	if err := profile.HandleCommand(ctx, &Rename{}); err == nil || errors.Is(err, ErrUnhandledCommand) {
+		t.Errorf("expected the handler error, got %v", err)
+	}
+}
+
+func TestRoutedAggregateUnhandled(t *testing.T) {
+	ctx := context.Background()
+	profile := newProfile(t)
+
+	if err := profile.HandleCommand(ctx, &Increment{}); !errors.Is(err, ErrUnhandledCommand) {
+		t.Errorf("got %v, want ErrUnhandledCommand", err)
+	}
+	if err := profile.ApplyEvent(ctx, &EventTested{}); !errors.Is(err, ErrUnhandledEvent) {
+		t.Errorf("got %v, want ErrUnhandledEvent", err)
+	}
+
+	unbound := &Profile{}
+	if err := unbound.HandleCommand(ctx, &Rename{Name: "bob"}); err != ErrAggregateNotRouted {
+		t.Errorf("got %v, want ErrAggregateNotRouted", err)
+	}
+	if err := RouteAggregate(unbound); err != nil {
+		t.Fatal(err)
+	}
+	if err := unbound.HandleCommand(ctx, &Rename{Name: "bob"}); err != nil {
+		t.Error(err)
+	}
+	if err := RouteAggregate(&Counter{}); err != ErrAggregateNotRouted {
+		t.Errorf("got %v, want ErrAggregateNotRouted", err)
+	}
+}
+
+// CopySnapshotStore loads snapshots by copying a stored aggregate over
+// the one given, the way the memory store does
+type CopySnapshotStore struct {
+	RecordingDataStore
+
+	snapshot *Profile
+}
+
+func (d *CopySnapshotStore) LoadSnapshot(ctx context.Context, revision string, aggregate Aggregate) error {
+	*aggregate.(*Profile) = *d.snapshot
+	return nil
+}
+
+func TestRoutedAggregateRebindsAfterSnapshot(t *testing.T) {
+	stale := newProfile(t)
+	store := &CopySnapshotStore{snapshot: stale}
+
+	factory := NewAggregateSourcedFactory(NewAggregateSourcedFunc(&Profile{}))
+	handler := NewAggregateHandler(factory, store, &TestBus{}, "", SnapshotEvery(100), false)
+	if err := handler.HandleCommand(context.Background(), &Rename{BaseCommand{AggregateID: "1"}, "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stale.Events()) != 0 {
+		t.Error("the command was handled by the snapshot copy")
+	}
+	if len(store.events) != 1 {
+		t.Errorf("got %d events, want 1", len(store.events))
+	}
+}
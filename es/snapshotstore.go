@@ -0,0 +1,51 @@
+package es
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrSnapshotStoreNotSupported when the datastore can't manage snapshots
+var ErrSnapshotStoreNotSupported = errors.New("DataStore does not support managing snapshots")
+
+// SnapshotRecord describes a stored snapshot
+type SnapshotRecord struct {
+	AggregateID   string
+	AggregateType string
+	Revision      string
+	Version       int
+}
+
+// SnapshotStore is implemented by datastores that can list and delete snapshots
+type SnapshotStore interface {
+	// SnapshotRevisions returns every revision that has at least one snapshot
+	SnapshotRevisions(context.Context) ([]string, error)
+	// ListSnapshots returns all the snapshots stored for a revision
+	ListSnapshots(context.Context, string) ([]*SnapshotRecord, error)
+	// DeleteSnapshots removes all the snapshots stored for a revision
+	DeleteSnapshots(context.Context, string) error
+}
+
+// PurgeStaleSnapshots deletes the snapshots of the tenant of ctx of every
+// revision but the current one
+func PurgeStaleSnapshots(ctx context.Context, dataStore DataStore, revision string) error {
+	store, ok := AsStore[SnapshotStore](dataStore)
+	if !ok {
+		return ErrSnapshotStoreNotSupported
+	}
+
+	revisions, err := store.SnapshotRevisions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range revisions {
+		if r == revision {
+			continue
+		}
+		if err := store.DeleteSnapshots(ctx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package es
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type TestSnapshotStore struct {
+	TestDataStore
+
+	sync.Mutex
+	revisions []string
+	deleted   []string
+	saved     int
+}
+
+func (d *TestSnapshotStore) SaveSnapshot(context.Context, string, Aggregate) error {
+	time.Sleep(10 * time.Millisecond)
+
+	d.Lock()
+	defer d.Unlock()
+	d.saved = d.saved + 1
+	return nil
+}
+func (d *TestSnapshotStore) SnapshotRevisions(context.Context) ([]string, error) {
+	return d.revisions, nil
+}
+func (d *TestSnapshotStore) ListSnapshots(context.Context, string) ([]*SnapshotRecord, error) {
+	return nil, nil
+}
+func (d *TestSnapshotStore) DeleteSnapshots(ctx context.Context, revision string) error {
+	d.deleted = append(d.deleted, revision)
+	return nil
+}
+
+func TestPurgeStaleSnapshots(t *testing.T) {
+	store := &TestSnapshotStore{revisions: []string{"v1", "v2", "v3"}}
+
+	if err := PurgeStaleSnapshots(context.TODO(), store, "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"v1", "v3"}; !reflect.DeepEqual(store.deleted, want) {
+		t.Errorf("got %v, want %v", store.deleted, want)
+	}
+
+	if err := PurgeStaleSnapshots(context.TODO(), &TestDataStore{}, "v2"); err != ErrSnapshotStoreNotSupported {
+		t.Errorf("got %v, want %v", err, ErrSnapshotStoreNotSupported)
+	}
+}
+
+func TestAsyncSnapshotStoreFlushesOnClose(t *testing.T) {
+	inner := &TestSnapshotStore{}
+	store := NewAsyncSnapshotStore(inner)
+
+	for _, id := range []string{"1", "2", "3"} {
+		aggregate := &SnapshotAggregate{}
+		aggregate.Initialize(id, "SnapshotAggregate")
+		if err := store.SaveSnapshot(context.TODO(), "v1", aggregate); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if inner.saved != 3 {
+		t.Errorf("got %d snapshots, want 3", inner.saved)
+	}
+}
+
+type orderedSnapshotStore struct {
+	TestDataStore
+
+	sync.Mutex
+	versions []int
+	contexts []context.Context
+}
+
+func (d *orderedSnapshotStore) SaveSnapshot(ctx context.Context, revision string, aggregate Aggregate) error {
+	time.Sleep(10 * time.Millisecond)
+
+	d.Lock()
+	defer d.Unlock()
+	d.versions = append(d.versions, versionOf(aggregate))
+	d.contexts = append(d.contexts, ctx)
+	return nil
+}
+
+func TestAsyncSnapshotStoreKeepsNewest(t *testing.T) {
+	inner := &orderedSnapshotStore{}
+	store := NewAsyncSnapshotStore(inner)
+
+	ctx, cancel := context.WithCancel(WithTenant(context.Background(), "acme"))
+	for _, version := range []int{1, 3, 2} {
+		aggregate := &SnapshotAggregate{}
+		aggregate.Initialize("1", "SnapshotAggregate")
+		for i := 0; i < version; i++ {
+			aggregate.IncrementVersion()
+		}
+		if err := store.SaveSnapshot(ctx, "v1", aggregate); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancel()
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []int{1, 3}; !reflect.DeepEqual(inner.versions, want) {
+		t.Errorf("got versions %v, want %v", inner.versions, want)
+	}
+	for _, ctx := range inner.contexts {
+		if ctx.Err() != nil || TenantFromContext(ctx) != "acme" {
+			t.Errorf("got a context of tenant %q, error %v", TenantFromContext(ctx), ctx.Err())
+		}
+	}
+}
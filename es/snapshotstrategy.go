@@ -0,0 +1,117 @@
+package es
+
+import "time"
+
+// SnapshotInfo describes an aggregate after a command has been handled
+type SnapshotInfo struct {
+	// Aggregate after all the events have been applied
+	Aggregate AggregateSourced
+	// SnapshotVersion is the version of the snapshot the aggregate was loaded from
+	SnapshotVersion int
+	// Replayed are the events applied on top of the snapshot.
+	//
+	// Deprecated: events are streamed so the handler leaves it empty, use
+	// FirstReplayed and ReplayedCount.
+	Replayed []*Event
+	// FirstReplayed is the oldest event applied on top of the snapshot
+	FirstReplayed *Event
+	// ReplayedCount is the number of events applied on top of the snapshot
+	ReplayedCount int
+	// Committed are the events produced by the command
+	Committed []*Event
+	// Now is the time the command was handled
+	Now time.Time
+}
+
+// SnapshotStrategy decides when snapshots are loaded and saved
+type SnapshotStrategy interface {
+	// ShouldLoad returns true if a snapshot should be loaded before replaying events
+	ShouldLoad() bool
+	// ShouldSave returns true if a new snapshot should be saved
+	ShouldSave(SnapshotInfo) bool
+}
+
+// SnapshotNever never loads or saves snapshots
+func SnapshotNever() SnapshotStrategy {
+	return &snapshotNever{}
+}
+
+type snapshotNever struct{}
+
+func (s *snapshotNever) ShouldLoad() bool {
+	return false
+}
+func (s *snapshotNever) ShouldSave(SnapshotInfo) bool {
+	return false
+}
+
+// SnapshotEvery saves a snapshot once the aggregate is n or more versions
+// ahead of the snapshot it was loaded from
+func SnapshotEvery(n int) SnapshotStrategy {
+	return &snapshotEvery{n}
+}
+
+type snapshotEvery struct {
+	n int
+}
+
+func (s *snapshotEvery) ShouldLoad() bool {
+	return true
+}
+func (s *snapshotEvery) ShouldSave(info SnapshotInfo) bool {
+	diff := info.Aggregate.GetVersion() - info.SnapshotVersion
+	return diff > 0 && diff >= s.n
+}
+
+// SnapshotAfter saves a snapshot once the oldest event not covered by the
+// snapshot is older than d
+func SnapshotAfter(d time.Duration) SnapshotStrategy {
+	return &snapshotAfter{d}
+}
+
+type snapshotAfter struct {
+	d time.Duration
+}
+
+func (s *snapshotAfter) ShouldLoad() bool {
+	return true
+}
+func (s *snapshotAfter) ShouldSave(info SnapshotInfo) bool {
+	var oldest *Event
+	switch {
+	case info.FirstReplayed != nil:
+		oldest = info.FirstReplayed
+	case len(info.Replayed) > 0:
+		oldest = info.Replayed[0]
+	case len(info.Committed) > 0:
+		oldest = info.Committed[0]
+	default:
+		return false
+	}
+	now := info.Now
+	if now.IsZero() {
+		now = GetTimestamp()
+	}
+	return now.Sub(oldest.Timestamp) >= s.d
+}
+
+// SnapshotOnEvent saves a snapshot when the command produced any of the events
+func SnapshotOnEvent(events ...interface{}) SnapshotStrategy {
+	return &snapshotOnEvent{MatchAnyEventOf(events...)}
+}
+
+type snapshotOnEvent struct {
+	matcher EventMatcher
+}
+
+func (s *snapshotOnEvent) ShouldLoad() bool {
+	return true
+}
+func (s *snapshotOnEvent) ShouldSave(info SnapshotInfo) bool {
+	for _, e := range info.Committed {
+		if s.matcher(e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package es
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// SnapshotAggregate for testing snapshot strategies
+type SnapshotAggregate struct {
+	BaseAggregateSourced
+}
+
+func (a *SnapshotAggregate) HandleCommand(context.Context, Command) error {
+	return nil
+}
+func (a *SnapshotAggregate) ApplyEvent(context.Context, interface{}) error {
+	return nil
+}
+
+func snapshotInfo(snapshotVersion, version int, replayed, committed []*Event) SnapshotInfo {
+	aggregate := &SnapshotAggregate{}
+	aggregate.Version = version
+	return SnapshotInfo{
+		Aggregate:       aggregate,
+		SnapshotVersion: snapshotVersion,
+		Replayed:        replayed,
+		Committed:       committed,
+	}
+}
+
+func TestSnapshotStrategies(t *testing.T) {
+	old := NewEvent(&EventTested{})
+	old.Timestamp = GetTimestamp().Add(-time.Hour)
+	recent := NewEvent(&EventTested{})
+
+	data := []struct {
+		name     string
+		strategy SnapshotStrategy
+		info     SnapshotInfo
+		load     bool
+		save     bool
+	}{
+		{"never", SnapshotNever(), snapshotInfo(0, 10, nil, nil), false, false},
+		{"every-below", SnapshotEvery(5), snapshotInfo(2, 6, nil, nil), true, false},
+		{"every-reached", SnapshotEvery(5), snapshotInfo(2, 7, nil, nil), true, true},
+		{"every-unchanged", SnapshotEvery(0), snapshotInfo(2, 2, nil, nil), true, false},
+		{"after-recent", SnapshotAfter(time.Minute), snapshotInfo(0, 1, nil, []*Event{recent}), true, false},
+		{"after-old", SnapshotAfter(time.Minute), snapshotInfo(0, 2, []*Event{old}, []*Event{recent}), true, true},
+		{"after-nothing", SnapshotAfter(time.Minute), snapshotInfo(0, 0, nil, nil), true, false},
+		{"event-other", SnapshotOnEvent(&Event1{}), snapshotInfo(0, 1, nil, []*Event{recent}), true, false},
+		{"event-match", SnapshotOnEvent(&EventTested{}), snapshotInfo(0, 1, nil, []*Event{recent}), true, true},
+	}
+
+	for _, tt := range data {
+		t.Run(tt.name, func(t *testing.T) {
+			if load := tt.strategy.ShouldLoad(); load != tt.load {
+				t.Errorf("ShouldLoad got %v, want %v", load, tt.load)
+			}
+			if save := tt.strategy.ShouldSave(tt.info); save != tt.save {
+				t.Errorf("ShouldSave got %v, want %v", save, tt.save)
+			}
+		})
+	}
+}
@@ -0,0 +1,487 @@
+// Package storetest is a conformance suite every es.DataStore implementation
+// should pass, run it from the tests of the implementation with Run.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/contextgg/go-es/es"
+)
+
+// Factory creates the datastore under test, events are decoded with the registry
+type Factory = func(es.EventRegistry) (es.DataStore, error)
+
+// ItemAdded is an event used by the suite
+type ItemAdded struct {
+	Name  string `bson:"name"`
+	Count int    `bson:"count"`
+}
+
+// ItemRemoved is an event used by the suite
+type ItemRemoved struct {
+	Name string `bson:"name"`
+}
+
+// Basket is an aggregate used by the suite
+type Basket struct {
+	es.BaseAggregateSourced
+
+	Items []string `bson:"items"`
+}
+
+// HandleCommand is not used by the suite
+func (b *Basket) HandleCommand(context.Context, es.Command) error {
+	return nil
+}
+
+// ApplyEvent is not used by the suite
+func (b *Basket) ApplyEvent(context.Context, interface{}) error {
+	return nil
+}
+
+// Wishlist is a second aggregate type to check types don't leak into each other
+type Wishlist struct {
+	Basket
+}
+
+var sequence int64
+
+// uniqueID so stores that are shared between runs don't collide
+func uniqueID() string {
+	n := atomic.AddInt64(&sequence, 1)
+	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), n)
+}
+
+func newEvent(id, aggregateType string, version int, data interface{}) *es.Event {
+	_, typeName := es.GetTypeName(data)
+	return &es.Event{
+		Type:          typeName,
+		Timestamp:     es.GetTimestamp(),
+		AggregateID:   id,
+		AggregateType: aggregateType,
+		Version:       version,
+		Data:          data,
+	}
+}
+
+func newBasket(id string, version int, items ...string) *Basket {
+	b := &Basket{Items: items}
+	b.Initialize(id, "Basket")
+	b.Version = version
+	return b
+}
+
+// Run the conformance suite against the datastore created by the factory
+func Run(t *testing.T, factory Factory) {
+	registry := es.NewEventRegistry()
+	registry.Set(&ItemAdded{}, false)
+	registry.Set(&ItemRemoved{}, false)
+
+	store, err := factory(registry)
+	require.NoError(t, err)
+	defer store.Close()
+
+	tests := []struct {
+		name string
+		fn   func(*testing.T, es.DataStore)
+	}{
+		{"SaveAndLoadEvents", testSaveAndLoadEvents},
+		{"LoadEventsFromVersion", testLoadEventsFromVersion},
+		{"LoadUnknownStream", testLoadUnknownStream},
+		{"VersionConflict", testVersionConflict},
+		{"MetadataRoundTrip", testMetadataRoundTrip},
+		{"TypeIsolation", testTypeIsolation},
+		{"SnapshotRevisions", testSnapshotRevisions},
+		{"SnapshotStore", testSnapshotStore},
+		{"ProjectionUpsert", testProjectionUpsert},
+		{"ProjectionDelete", testProjectionDelete},
+		{"StreamStore", testStreamStore},
+		{"TenantIsolation", testTenantIsolation},
+		{"NestedTenants", testNestedTenants},
+		{"ArchiveStore", testArchiveStore},
+		{"EventStream", testEventStream},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, store)
+		})
+	}
+}
+
+func testSaveAndLoadEvents(t *testing.T, store es.DataStore) {
+	ctx := context.Background()
+	id := uniqueID()
+
+	events := []*es.Event{
+		newEvent(id, "Basket", 1, &ItemAdded{Name: "apple", Count: 2}),
+		newEvent(id, "Basket", 2, &ItemRemoved{Name: "apple"}),
+	}
+	require.NoError(t, store.SaveEvents(ctx, events, 0))
+
+	loaded, err := store.LoadEvents(ctx, id, "Basket", 0)
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+
+	for i, e := range loaded {
+		assert.Equal(t, events[i].Type, e.Type)
+		assert.Equal(t, events[i].Version, e.Version)
+		assert.Equal(t, id, e.AggregateID)
+		assert.Equal(t, "Basket", e.AggregateType)
+		assert.Equal(t, events[i].Data, e.Data)
+		assert.WithinDuration(t, events[i].Timestamp, e.Timestamp, time.Millisecond)
+	}
+}
+
+func testLoadEventsFromVersion(t *testing.T, store es.DataStore) {
+	ctx := context.Background()
+	id := uniqueID()
+
+	events := []*es.Event{
+		newEvent(id, "Basket", 1, &ItemAdded{Name: "apple"}),
+		newEvent(id, "Basket", 2, &ItemAdded{Name: "pear"}),
+		newEvent(id, "Basket", 3, &ItemAdded{Name: "plum"}),
+	}
+	require.NoError(t, store.SaveEvents(ctx, events, 0))
+
+	loaded, err := store.LoadEvents(ctx, id, "Basket", 2)
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	assert.Equal(t, 3, loaded[0].Version)
+
+	loaded, err = store.LoadEvents(ctx, id, "Basket", 3)
+	require.NoError(t, err)
+	assert.Len(t, loaded, 0)
+}
+
+func testLoadUnknownStream(t *testing.T, store es.DataStore) {
+	loaded, err := store.LoadEvents(context.Background(), uniqueID(), "Basket", 0)
+	require.NoError(t, err)
+	assert.Len(t, loaded, 0)
+}
+
+func testVersionConflict(t *testing.T, store es.DataStore) {
+	ctx := context.Background()
+	id := uniqueID()
+
+	first := []*es.Event{newEvent(id, "Basket", 1, &ItemAdded{Name: "apple"})}
+	require.NoError(t, store.SaveEvents(ctx, first, 0))
+
+	// someone else saved version 1 already
+	conflict := []*es.Event{newEvent(id, "Basket", 1, &ItemAdded{Name: "pear"})}
+	err := store.SaveEvents(ctx, conflict, 0)
+	assert.True(t, errors.Is(err, es.ErrVersionMismatch), "got %v, want %v", err, es.ErrVersionMismatch)
+
+	// and we can't skip versions either
+	ahead := []*es.Event{newEvent(id, "Basket", 3, &ItemAdded{Name: "plum"})}
+	err = store.SaveEvents(ctx, ahead, 2)
+	assert.True(t, errors.Is(err, es.ErrVersionMismatch), "got %v, want %v", err, es.ErrVersionMismatch)
+
+	loaded, err := store.LoadEvents(ctx, id, "Basket", 0)
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	assert.Equal(t, &ItemAdded{Name: "apple"}, loaded[0].Data)
+}
+
+func testMetadataRoundTrip(t *testing.T, store es.DataStore) {
+	ctx := context.Background()
+	id := uniqueID()
+
+	event := newEvent(id, "Basket", 1, &ItemAdded{Name: "apple"})
+	event.Metadata = es.Metadata{"user_id": "u1", "source": "storetest"}
+	require.NoError(t, store.SaveEvents(ctx, []*es.Event{event}, 0))
+
+	loaded, err := store.LoadEvents(ctx, id, "Basket", 0)
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	assert.Equal(t, event.Metadata, loaded[0].Metadata)
+}
+
+func testTypeIsolation(t *testing.T, store es.DataStore) {
+	ctx := context.Background()
+	id := uniqueID()
+
+	require.NoError(t, store.SaveEvents(ctx, []*es.Event{newEvent(id, "Basket", 1, &ItemAdded{Name: "apple"})}, 0))
+	require.NoError(t, store.SaveEvents(ctx, []*es.Event{newEvent(id, "Wishlist", 1, &ItemAdded{Name: "pear"})}, 0))
+
+	loaded, err := store.LoadEvents(ctx, id, "Wishlist", 0)
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	assert.Equal(t, &ItemAdded{Name: "pear"}, loaded[0].Data)
+
+	basket := newBasket(id, 1, "apple")
+	wishlist := &Wishlist{Basket: *newBasket(id, 1, "pear")}
+	wishlist.Initialize(id, "Wishlist")
+	require.NoError(t, store.SaveSnapshot(ctx, "v1", basket))
+	require.NoError(t, store.SaveSnapshot(ctx, "v1", wishlist))
+	require.NoError(t, store.SaveAggregate(ctx, basket))
+	require.NoError(t, store.SaveAggregate(ctx, wishlist))
+
+	snapshot := newBasket(id, 0)
+	require.NoError(t, store.LoadSnapshot(ctx, "v1", snapshot))
+	assert.Equal(t, []string{"apple"}, snapshot.Items)
+
+	projection := newBasket(id, 0)
+	require.NoError(t, store.LoadAggregate(ctx, projection))
+	assert.Equal(t, []string{"apple"}, projection.Items)
+}
+
+func testSnapshotRevisions(t *testing.T, store es.DataStore) {
+	ctx := context.Background()
+	id := uniqueID()
+
+	require.NoError(t, store.SaveSnapshot(ctx, "v1", newBasket(id, 2, "apple")))
+	require.NoError(t, store.SaveSnapshot(ctx, "v2", newBasket(id, 3, "apple", "pear")))
+	require.NoError(t, store.SaveSnapshot(ctx, "v1", newBasket(id, 4, "plum")))
+
+	snapshot := newBasket(id, 0)
+	require.NoError(t, store.LoadSnapshot(ctx, "v1", snapshot))
+	assert.Equal(t, 4, snapshot.GetVersion())
+	assert.Equal(t, []string{"plum"}, snapshot.Items)
+
+	snapshot = newBasket(id, 0)
+	require.NoError(t, store.LoadSnapshot(ctx, "v2", snapshot))
+	assert.Equal(t, 3, snapshot.GetVersion())
+
+	// a missing snapshot leaves the aggregate untouched
+	snapshot = newBasket(id, 0)
+	require.NoError(t, store.LoadSnapshot(ctx, "v3", snapshot))
+	assert.Equal(t, 0, snapshot.GetVersion())
+	assert.Equal(t, id, snapshot.GetID())
+}
+
+func testSnapshotStore(t *testing.T, store es.DataStore) {
+	snapshots, ok := es.AsStore[es.SnapshotStore](store)
+	if !ok {
+		t.Skip("DataStore is not an es.SnapshotStore")
+	}
+
+	ctx := context.Background()
+	id := uniqueID()
+	revision := "rev-" + id
+
+	require.NoError(t, store.SaveSnapshot(ctx, revision, newBasket(id, 2, "apple")))
+
+	revisions, err := snapshots.SnapshotRevisions(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, revisions, revision)
+
+	records, err := snapshots.ListSnapshots(ctx, revision)
+	require.NoError(t, err)
+	assert.Equal(t, []*es.SnapshotRecord{{
+		AggregateID:   id,
+		AggregateType: "Basket",
+		Revision:      revision,
+		Version:       2,
+	}}, records)
+
+	require.NoError(t, snapshots.DeleteSnapshots(ctx, revision))
+
+	records, err = snapshots.ListSnapshots(ctx, revision)
+	require.NoError(t, err)
+	assert.Len(t, records, 0)
+
+	snapshot := newBasket(id, 0)
+	require.NoError(t, store.LoadSnapshot(ctx, revision, snapshot))
+	assert.Equal(t, 0, snapshot.GetVersion())
+}
+
+func testProjectionUpsert(t *testing.T, store es.DataStore) {
+	ctx := context.Background()
+	id := uniqueID()
+
+	require.NoError(t, store.SaveAggregate(ctx, newBasket(id, 1, "apple")))
+	require.NoError(t, store.SaveAggregate(ctx, newBasket(id, 2, "apple", "pear")))
+
+	projection := newBasket(id, 0)
+	require.NoError(t, store.LoadAggregate(ctx, projection))
+	assert.Equal(t, 2, projection.GetVersion())
+	assert.Equal(t, []string{"apple", "pear"}, projection.Items)
+
+	// a missing projection leaves the aggregate untouched
+	missing := newBasket(uniqueID(), 0)
+	require.NoError(t, store.LoadAggregate(ctx, missing))
+	assert.Equal(t, 0, missing.GetVersion())
+}
+
+func testProjectionDelete(t *testing.T, store es.DataStore) {
+	deleter, ok := es.AsStore[es.AggregateDeleter](store)
+	if !ok {
+		t.Skip("DataStore is not an es.AggregateDeleter")
+	}
+
+	ctx := context.Background()
+	id := uniqueID()
+	require.NoError(t, store.SaveAggregate(ctx, newBasket(id, 1, "apple")))
+	require.NoError(t, deleter.DeleteAggregate(ctx, newBasket(id, 0)))
+
+	projection := newBasket(id, 0)
+	require.NoError(t, store.LoadAggregate(ctx, projection))
+	assert.Equal(t, 0, projection.GetVersion())
+	assert.Empty(t, projection.Items)
+
+	// deleting twice is fine
+	require.NoError(t, deleter.DeleteAggregate(ctx, newBasket(id, 0)))
+}
+
+func testStreamStore(t *testing.T, store es.DataStore) {
+	streams, ok := es.AsStore[es.StreamStore](store)
+	if !ok {
+		t.Skip("DataStore is not an es.StreamStore")
+	}
+
+	ctx := context.Background()
+	id := uniqueID()
+	require.NoError(t, store.SaveEvents(ctx, []*es.Event{newEvent(id, "Basket", 1, &ItemAdded{Name: "apple"})}, 0))
+
+	typeNames, err := streams.AggregateTypes(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, typeNames, "Basket")
+
+	ids, err := streams.AggregateIDs(ctx, "Basket")
+	require.NoError(t, err)
+	assert.Contains(t, ids, id)
+}
+
+func testTenantIsolation(t *testing.T, store es.DataStore) {
+	acme := es.WithTenant(context.Background(), "acme")
+	globex := es.WithTenant(context.Background(), "globex")
+	id := uniqueID()
+
+	// the same stream can exist once per tenant
+	require.NoError(t, store.SaveEvents(acme, []*es.Event{newEvent(id, "Basket", 1, &ItemAdded{Name: "apple"})}, 0))
+	require.NoError(t, store.SaveEvents(globex, []*es.Event{newEvent(id, "Basket", 1, &ItemAdded{Name: "pear"})}, 0))
+
+	events, err := store.LoadEvents(acme, id, "Basket", 0)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "apple", events[0].Data.(*ItemAdded).Name)
+
+	events, err = store.LoadEvents(context.Background(), id, "Basket", 0)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	require.NoError(t, store.SaveAggregate(acme, newBasket(id, 1, "apple")))
+	projection := newBasket(id, 0)
+	require.NoError(t, store.LoadAggregate(globex, projection))
+	assert.Equal(t, 0, projection.GetVersion())
+
+	if streams, ok := es.AsStore[es.StreamStore](store); ok {
+		ids, err := streams.AggregateIDs(globex, "Basket")
+		require.NoError(t, err)
+		assert.Equal(t, []string{id}, ids)
+	}
+}
+
+func testNestedTenants(t *testing.T, store es.DataStore) {
+	a := es.WithTenant(context.Background(), "a")
+	ab := es.WithTenant(context.Background(), "a/b")
+	id := uniqueID()
+
+	require.NoError(t, store.SaveEvents(ab, []*es.Event{newEvent(id, "Basket", 1, &ItemAdded{Name: "apple"})}, 0))
+	require.NoError(t, store.SaveAggregate(ab, newBasket(id, 1, "apple")))
+
+	events, err := store.LoadEvents(a, id, "b/Basket", 0)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	projection := newBasket(id, 0)
+	require.NoError(t, store.LoadAggregate(a, projection))
+	assert.Equal(t, 0, projection.GetVersion())
+
+	if streams, ok := es.AsStore[es.StreamStore](store); ok {
+		typeNames, err := streams.AggregateTypes(a)
+		require.NoError(t, err)
+		assert.Empty(t, typeNames)
+	}
+}
+
+func testArchiveStore(t *testing.T, store es.DataStore) {
+	archive, ok := es.AsStore[es.ArchiveStore](store)
+	if !ok {
+		t.Skip("DataStore is not an es.ArchiveStore")
+	}
+
+	ctx := context.Background()
+	id := uniqueID()
+	events := []*es.Event{}
+	for v := 1; v <= 5; v++ {
+		events = append(events, newEvent(id, "Basket", v, &ItemAdded{Name: "apple", Count: v}))
+	}
+	require.NoError(t, store.SaveEvents(ctx, events, 0))
+
+	n, err := archive.ArchiveEvents(ctx, id, "Basket", 4)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	n, err = archive.ArchiveEvents(ctx, id, "Basket", 4)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// a replay from zero reads the archive back
+	loaded, err := store.LoadEvents(ctx, id, "Basket", 0)
+	require.NoError(t, err)
+	require.Len(t, loaded, 5)
+	for i, e := range loaded {
+		assert.Equal(t, i+1, e.Version)
+		assert.Equal(t, i+1, e.Data.(*ItemAdded).Count)
+	}
+
+	loaded, err = store.LoadEvents(ctx, id, "Basket", 3)
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+	assert.Equal(t, 4, loaded[0].Version)
+
+	stream, err := es.LoadEventStream(ctx, store, id, "Basket", 1)
+	require.NoError(t, err)
+	loaded, err = es.CollectEvents(ctx, stream)
+	require.NoError(t, err)
+	require.Len(t, loaded, 4)
+	assert.Equal(t, 2, loaded[0].Version)
+
+	// the last event is never archived so the stream can still be appended to
+	n, err = archive.ArchiveEvents(ctx, id, "Basket", 100)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.NoError(t, store.SaveEvents(ctx, []*es.Event{newEvent(id, "Basket", 6, &ItemRemoved{Name: "apple"})}, 5))
+
+	loaded, err = store.LoadEvents(ctx, id, "Basket", 0)
+	require.NoError(t, err)
+	assert.Len(t, loaded, 6)
+}
+
+func testEventStream(t *testing.T, store es.DataStore) {
+	ctx := context.Background()
+	id := uniqueID()
+	events := []*es.Event{}
+	for v := 1; v <= 5; v++ {
+		events = append(events, newEvent(id, "Basket", v, &ItemAdded{Name: "apple", Count: v}))
+	}
+	require.NoError(t, store.SaveEvents(ctx, events, 0))
+
+	stream, err := es.LoadEventStream(ctx, store, id, "Basket", 2)
+	require.NoError(t, err)
+	defer stream.Close(ctx)
+
+	version := 2
+	for stream.Next(ctx) {
+		version++
+		assert.Equal(t, version, stream.Event().Version)
+		assert.Equal(t, version, stream.Event().Data.(*ItemAdded).Count)
+	}
+	require.NoError(t, stream.Err())
+	assert.Equal(t, 5, version)
+
+	stream, err = es.LoadEventStream(ctx, store, uniqueID(), "Basket", 0)
+	require.NoError(t, err)
+	assert.False(t, stream.Next(ctx))
+	assert.NoError(t, stream.Close(ctx))
+}
@@ -0,0 +1,17 @@
+package es
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrStreamStoreNotSupported when the datastore can't enumerate its streams
+var ErrStreamStoreNotSupported = errors.New("DataStore does not support listing streams")
+
+// StreamStore is implemented by datastores that can enumerate their event streams
+type StreamStore interface {
+	// AggregateTypes returns every aggregate type that has events
+	AggregateTypes(context.Context) ([]string, error)
+	// AggregateIDs returns the ID of every aggregate of a type that has events
+	AggregateIDs(context.Context, string) ([]string, error)
+}
@@ -0,0 +1,17 @@
+package es
+
+import "context"
+
+type tenantKey struct{}
+
+// WithTenant returns a context for the tenant, stores and publishers keep
+// the data of each tenant apart
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant of ctx, empty when there is none
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
@@ -0,0 +1,35 @@
+package es
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAggregateHandlerTenant(t *testing.T) {
+	store := &RecordingDataStore{}
+	factory := NewAggregateSourcedFactory(NewAggregateSourcedFunc(&ClockAggregate{}))
+	handler := NewAggregateHandler(factory, store, &TestBus{}, "", nil, false)
+
+	ctx := WithTenant(context.Background(), "acme")
+	if err := handler.HandleCommand(ctx, &TickCommand{BaseCommand{AggregateID: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.events) != 1 || store.events[0].Tenant != "acme" {
+		t.Errorf("got %v", store.events)
+	}
+}
+
+func TestEventBusTenant(t *testing.T) {
+	bus := NewEventBus(NewEventRegistry(), EventHandlerFunc(func(context.Context, *Event) error {
+		return nil
+	}))
+
+	evt := NewEvent(&EventTested{})
+	if err := bus.HandleEvent(WithTenant(context.Background(), "acme"), evt); err != nil {
+		t.Fatal(err)
+	}
+	if evt.Tenant != "acme" {
+		t.Errorf("got tenant %q, want acme", evt.Tenant)
+	}
+}
@@ -0,0 +1,142 @@
+package es
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name of the spans we create
+const TracerName = "github.com/contextgg/go-es"
+
+// tracePropagator writes span contexts into event metadata and messages
+var tracePropagator = propagation.TraceContext{}
+
+type tracerProviderKey struct{}
+
+// WithTracerProvider returns a context carrying the tracer provider
+func WithTracerProvider(ctx context.Context, tp trace.TracerProvider) context.Context {
+	return context.WithValue(ctx, tracerProviderKey{}, tp)
+}
+
+// tracerFromContext returns a no-op tracer unless tracing was enabled
+func tracerFromContext(ctx context.Context) trace.Tracer {
+	if tp, ok := ctx.Value(tracerProviderKey{}).(trace.TracerProvider); ok && tp != nil {
+		return tp.Tracer(TracerName)
+	}
+	return trace.NewNoopTracerProvider().Tracer(TracerName)
+}
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracerFromContext(ctx).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traced runs fn in a child span of ctx
+func traced(ctx context.Context, name string, fn func(context.Context) error) error {
+	ctx, span := startSpan(ctx, name)
+	err := fn(ctx)
+	endSpan(span, err)
+	return err
+}
+
+// CommandTracingMiddleware starts a span for every command
+func CommandTracingMiddleware(tp trace.TracerProvider) CommandHandlerMiddleware {
+	return func(h CommandHandler) CommandHandler {
+		return CommandHandlerFunc(func(ctx context.Context, cmd Command) (err error) {
+			_, name := GetTypeName(cmd)
+
+			ctx = WithTracerProvider(ctx, tp)
+			ctx, span := startSpan(ctx, "es.HandleCommand "+name,
+				attribute.String("es.command", name),
+				attribute.String("es.aggregate_id", cmd.GetAggregateID()),
+			)
+			defer func() { endSpan(span, err) }()
+
+			return h.HandleCommand(ctx, cmd)
+		})
+	}
+}
+
+// EventTracingMiddleware starts a span for every event, continuing the trace
+// stored in the event metadata when the context has none
+func EventTracingMiddleware(tp trace.TracerProvider) EventHandlerMiddleware {
+	return func(h EventHandler) EventHandler {
+		return EventHandlerFunc(func(ctx context.Context, evt *Event) (err error) {
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				ctx = ExtractTrace(ctx, MetadataCarrier(evt))
+			}
+
+			ctx = WithTracerProvider(ctx, tp)
+			ctx, span := startSpan(ctx, "es.HandleEvent "+evt.Type, eventAttributes(evt)...)
+			defer func() { endSpan(span, err) }()
+
+			return h.HandleEvent(ctx, evt)
+		})
+	}
+}
+
+func eventAttributes(evt *Event) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("es.event", evt.Type),
+		attribute.String("es.aggregate_id", evt.AggregateID),
+		attribute.String("es.aggregate_type", evt.AggregateType),
+		attribute.Int("es.version", evt.Version),
+	}
+}
+
+// InjectTrace writes the span context of ctx into the carrier
+func InjectTrace(ctx context.Context, carrier propagation.TextMapCarrier) {
+	tracePropagator.Inject(ctx, carrier)
+}
+
+// ExtractTrace reads a span context from the carrier into ctx
+func ExtractTrace(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return tracePropagator.Extract(ctx, carrier)
+}
+
+// MetadataCarrier lets a span context travel in the metadata of an event
+func MetadataCarrier(evt *Event) propagation.TextMapCarrier {
+	return &metadataCarrier{evt}
+}
+
+type metadataCarrier struct {
+	evt *Event
+}
+
+func (c *metadataCarrier) Get(key string) string {
+	v, ok := c.evt.Metadata[key]
+	if !ok {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+func (c *metadataCarrier) Set(key string, value string) {
+	if c.evt.Metadata == nil {
+		c.evt.Metadata = make(Metadata)
+	}
+	c.evt.Metadata[key] = value
+}
+
+func (c *metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.evt.Metadata))
+	for k := range c.evt.Metadata {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,88 @@
+package es
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTracerProvider() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), exporter
+}
+
+func TestCommandTracing(t *testing.T) {
+	tp, exporter := newTracerProvider()
+
+	store := &RecordingDataStore{}
+	factory := NewAggregateSourcedFactory(NewAggregateSourcedFunc(&ClockAggregate{}))
+	handler := UseCommandHandlerMiddleware(
+		NewAggregateHandler(factory, store, &TestBus{}, "", nil, true),
+		CommandTracingMiddleware(tp),
+	)
+
+	if err := handler.HandleCommand(context.Background(), &TickCommand{BaseCommand{AggregateID: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	names := map[string]tracetest.SpanStub{}
+	for _, s := range spans {
+		names[s.Name] = s
+	}
+
+	root, ok := names["es.HandleCommand TickCommand"]
+	if !ok {
+		t.Fatalf("no command span in %v", spans)
+	}
+	for _, name := range []string{"es.LoadEvents", "es.Aggregate.HandleCommand", "es.SaveEvents", "es.SaveAggregate", "es.PublishEvents"} {
+		s, ok := names[name]
+		if !ok {
+			t.Errorf("no %s span", name)
+			continue
+		}
+		if s.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Errorf("%s is not a child of the command span", name)
+		}
+	}
+
+	// the stored event carries the trace so consumers can continue it
+	if len(store.events) != 1 {
+		t.Fatalf("got %d events, want 1", len(store.events))
+	}
+	ctx := ExtractTrace(context.Background(), MetadataCarrier(store.events[0]))
+	if got := trace.SpanContextFromContext(ctx).TraceID(); got != root.SpanContext.TraceID() {
+		t.Errorf("got trace %s, want %s", got, root.SpanContext.TraceID())
+	}
+}
+
+func TestEventTracingContinuesMetadata(t *testing.T) {
+	tp, exporter := newTracerProvider()
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "producer")
+	evt := NewEvent(&EventTested{"traced"})
+	InjectTrace(ctx, MetadataCarrier(evt))
+	parent.End()
+
+	handler := UseEventHandlerMiddleware(
+		EventHandlerFunc(func(context.Context, *Event) error { return nil }),
+		EventTracingMiddleware(tp),
+	)
+	if err := handler.HandleEvent(context.Background(), evt); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range exporter.GetSpans() {
+		if s.Name != "es.HandleEvent EventTested" {
+			continue
+		}
+		if s.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("event span is not a child of the producer")
+		}
+		return
+	}
+	t.Error("no event span")
+}
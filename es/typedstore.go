@@ -0,0 +1,40 @@
+package es
+
+import "context"
+
+// NewTypedAggregateStore creates a store that loads and saves T without
+// type assertions, T must be a pointer to a struct
+func NewTypedAggregateStore[T Aggregate](dataStore DataStore, bus EventBus, opts ...AggregateStoreOption) *TypedAggregateStore[T] {
+	var aggregate T
+	return AsTypedAggregateStore[T](NewAggregateStore(NewAggregateFactory(aggregate), dataStore, bus, opts...))
+}
+
+// AsTypedAggregateStore wraps a store whose factory creates T
+func AsTypedAggregateStore[T Aggregate](store *AggregateStore) *TypedAggregateStore[T] {
+	return &TypedAggregateStore[T]{store}
+}
+
+// TypedAggregateStore for loading and saving aggregates of type T
+type TypedAggregateStore[T Aggregate] struct {
+	store *AggregateStore
+}
+
+// LoadAggregate from the datastore
+func (s *TypedAggregateStore[T]) LoadAggregate(ctx context.Context, id string) (T, error) {
+	var zero T
+
+	aggregate, err := s.store.LoadAggregate(ctx, id)
+	if err != nil {
+		return zero, err
+	}
+	typed, ok := aggregate.(T)
+	if !ok {
+		return zero, ErrInvalidAggregateType
+	}
+	return typed, nil
+}
+
+// SaveAggregate and handle events if needed
+func (s *TypedAggregateStore[T]) SaveAggregate(ctx context.Context, aggregate T) error {
+	return s.store.SaveAggregate(ctx, aggregate)
+}
@@ -0,0 +1,31 @@
+package tool
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/contextgg/go-es/builder"
+	"github.com/contextgg/go-es/es"
+)
+
+func archive(ctx context.Context, cli *builder.Client, args []string, stderr io.Writer) error {
+	var revision string
+
+	flags := flag.NewFlagSet("archive", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&revision, "revision", "", "snapshot revision the archived events are covered by")
+	ctx, err := parseFlags(ctx, flags, args)
+	if err != nil {
+		return err
+	}
+
+	if len(revision) == 0 {
+		return fmt.Errorf("archive requires -revision")
+	}
+
+	n, err := es.ArchiveSnapshotted(ctx, cli.DataStore, revision)
+	fmt.Fprintf(stderr, "%d events archived\n", n)
+	return err
+}
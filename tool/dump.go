@@ -0,0 +1,39 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/contextgg/go-es/builder"
+)
+
+func dump(ctx context.Context, cli *builder.Client, args []string, stdout, stderr io.Writer) error {
+	var aggregateType, id string
+	var fromVersion int
+
+	flags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&aggregateType, "type", "", "aggregate type of the stream")
+	flags.StringVar(&id, "id", "", "aggregate ID of the stream")
+	flags.IntVar(&fromVersion, "from", 0, "only dump events after this version")
+	ctx, err := parseFlags(ctx, flags, args)
+	if err != nil {
+		return err
+	}
+
+	if len(aggregateType) == 0 || len(id) == 0 {
+		return fmt.Errorf("dump requires -type and -id")
+	}
+
+	events, err := cli.DataStore.LoadEvents(ctx, id, aggregateType, fromVersion)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(events)
+}
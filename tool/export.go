@@ -0,0 +1,101 @@
+package tool
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/contextgg/go-es/builder"
+	"github.com/contextgg/go-es/es"
+)
+
+func export(ctx context.Context, cli *builder.Client, args []string, stdout, stderr io.Writer) error {
+	var aggregateType, id, out string
+
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&aggregateType, "type", "", "aggregate type to export, every stream when empty")
+	flags.StringVar(&id, "id", "", "aggregate ID to export, requires -type")
+	flags.StringVar(&out, "out", "", "file to write to, stdout when empty")
+	ctx, err := parseFlags(ctx, flags, args)
+	if err != nil {
+		return err
+	}
+
+	if len(id) > 0 && len(aggregateType) == 0 {
+		return fmt.Errorf("-id requires -type")
+	}
+
+	w := stdout
+	if len(out) > 0 {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var n int
+	switch {
+	case len(id) > 0:
+		n, err = es.ExportStream(ctx, cli.DataStore, w, aggregateType, id)
+	case len(aggregateType) > 0:
+		n, err = es.Export(ctx, cli.DataStore, w, aggregateType)
+	default:
+		n, err = es.Export(ctx, cli.DataStore, w)
+	}
+
+	fmt.Fprintf(stderr, "%d events exported\n", n)
+	return err
+}
+
+func importEvents(ctx context.Context, cli *builder.Client, args []string, stdin io.Reader, stderr io.Writer) error {
+	var in string
+	var dryRun bool
+
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&in, "in", "", "file to read from, stdin when empty")
+	flags.BoolVar(&dryRun, "dry-run", false, "validate the events without writing them")
+	ctx, err := parseFlags(ctx, flags, args)
+	if err != nil {
+		return err
+	}
+
+	r := stdin
+	if len(in) > 0 {
+		f, err := os.Open(in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	dataStore := cli.DataStore
+	if dryRun {
+		dataStore = &readOnlyStore{dataStore}
+	}
+
+	n, err := es.Import(ctx, dataStore, r, eventData(cli.EventRegistry))
+	if dryRun {
+		fmt.Fprintf(stderr, "%d events validated\n", n)
+	} else {
+		fmt.Fprintf(stderr, "%d events imported\n", n)
+	}
+	return err
+}
+
+// eventData creates registered events, unknown ones are kept as plain maps
+// so streams can be moved without wiring every type
+func eventData(registry es.EventRegistry) es.EventDataFactory {
+	return func(name string) (interface{}, error) {
+		if registry.Has(name) {
+			return registry.Get(name)
+		}
+		return &map[string]interface{}{}, nil
+	}
+}
@@ -0,0 +1,121 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/contextgg/go-es/es"
+	"github.com/contextgg/go-es/es/basic"
+)
+
+func TestExportImport(t *testing.T) {
+	cli := newClient(t)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	n, err := es.Export(ctx, cli.DataStore, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || strings.Count(buf.String(), "\n") != 3 {
+		t.Fatalf("got %d events exported: %s", n, buf.String())
+	}
+
+	target := basic.NewMemoryStore()
+	if n, err := es.Import(ctx, target, &buf, eventData(cli.EventRegistry)); err != nil || n != 3 {
+		t.Fatalf("got %d events imported: %v", n, err)
+	}
+
+	want, _ := cli.DataStore.LoadEvents(ctx, "2", "Auth", 0)
+	got, _ := target.LoadEvents(ctx, "2", "Auth", 0)
+	if len(got) != 1 || got[0].Version != 1 || !got[0].Timestamp.Equal(want[0].Timestamp) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if !reflect.DeepEqual(got[0].Data, want[0].Data) {
+		t.Errorf("got %+v, want %+v", got[0].Data, want[0].Data)
+	}
+}
+
+func TestImportTenant(t *testing.T) {
+	cli := newClient(t)
+	ctx := es.WithTenant(context.Background(), "acme")
+
+	cmd := &Login{BaseCommand: es.BaseCommand{AggregateID: "4"}, Username: "user4"}
+	if err := cli.CommandBus.HandleCommand(ctx, cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := es.Export(ctx, cli.DataStore, &buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := buf.String()
+
+	target := basic.NewMemoryStore()
+	_, err := es.Import(context.Background(), target, strings.NewReader(lines), eventData(cli.EventRegistry))
+	if !errors.Is(err, es.ErrTenantMismatch) || !strings.HasPrefix(err.Error(), "line 1:") {
+		t.Errorf("got %v, want %v on line 1", err, es.ErrTenantMismatch)
+	}
+
+	if n, err := es.Import(ctx, target, strings.NewReader(lines), eventData(cli.EventRegistry)); err != nil || n != 1 {
+		t.Fatalf("got %d events imported: %v", n, err)
+	}
+	got, _ := target.LoadEvents(ctx, "4", "Auth", 0)
+	if len(got) != 1 || got[0].Tenant != "acme" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestImportVersionGap(t *testing.T) {
+	lines := `{"type":"LoggedIn","aggregate_id":"1","aggregate_type":"Auth","version":1,"data":{"Username":"a"}}
+{"type":"LoggedIn","aggregate_id":"1","aggregate_type":"Auth","version":3,"data":{"Username":"b"}}
+`
+	cli := newClient(t)
+	target := basic.NewMemoryStore()
+
+	_, err := es.Import(context.Background(), target, strings.NewReader(lines), eventData(cli.EventRegistry))
+	if !errors.Is(err, es.ErrVersionGap) || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("got %v, want %v on line 2", err, es.ErrVersionGap)
+	}
+
+	// the stream already has version 1 in the client
+	_, err = es.Import(context.Background(), cli.DataStore, strings.NewReader(lines), eventData(cli.EventRegistry))
+	if !errors.Is(err, es.ErrVersionGap) {
+		t.Errorf("got %v, want %v", err, es.ErrVersionGap)
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	cli := newClient(t)
+
+	// more than a batch so the second one has to follow the first
+	var lines strings.Builder
+	for v := 1; v <= 600; v++ {
+		fmt.Fprintf(&lines, `{"type":"LoggedIn","aggregate_id":"9","aggregate_type":"Auth","version":%d,"data":{"Username":"a"}}`+"\n", v)
+	}
+	in := filepath.Join(t.TempDir(), "auth.ndjson")
+	if err := os.WriteFile(in, []byte(lines.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	args := []string{"import", "-in", in, "-dry-run"}
+	if err := Run(context.Background(), cli, args, &bytes.Buffer{}, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stderr.String(), "600 events validated\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	events, _ := cli.DataStore.LoadEvents(context.Background(), "9", "Auth", 0)
+	if len(events) != 0 {
+		t.Errorf("dry-run imported %d events", len(events))
+	}
+}
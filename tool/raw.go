@@ -0,0 +1,52 @@
+package tool
+
+import (
+	"context"
+
+	"github.com/contextgg/go-es/es"
+)
+
+// rawAggregate applies any event without keeping state, replaying it checks
+// a stream loads, decodes and follows its lifecycle without the aggregate
+// code of the service
+type rawAggregate struct {
+	es.BaseAggregateSourced
+}
+
+func (a *rawAggregate) HandleCommand(context.Context, es.Command) error {
+	return nil
+}
+func (a *rawAggregate) ApplyEvent(context.Context, interface{}) error {
+	return nil
+}
+
+func rawAggregateFactory(typeName string) es.AggregateSourcedFactory {
+	return func(id string) (es.AggregateSourced, error) {
+		aggregate := &rawAggregate{}
+		aggregate.Initialize(id, typeName)
+		return aggregate, nil
+	}
+}
+
+// rawAggregates returns a raw aggregate for the type, or for every type with
+// events in the datastore when it's empty
+func rawAggregates(ctx context.Context, dataStore es.DataStore, aggregateType string) (map[string]es.AggregateSourcedFactory, error) {
+	typeNames := []string{aggregateType}
+	if len(aggregateType) == 0 {
+		streams, ok := es.AsStore[es.StreamStore](dataStore)
+		if !ok {
+			return nil, es.ErrStreamStoreNotSupported
+		}
+
+		var err error
+		if typeNames, err = streams.AggregateTypes(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	aggregates := make(map[string]es.AggregateSourcedFactory, len(typeNames))
+	for _, typeName := range typeNames {
+		aggregates[typeName] = rawAggregateFactory(typeName)
+	}
+	return aggregates, nil
+}
@@ -0,0 +1,227 @@
+package tool
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/contextgg/go-es/builder"
+	"github.com/contextgg/go-es/es"
+)
+
+// progressEvery is how many aggregates are replayed between progress reports
+const progressEvery = 100
+
+type replayOptions struct {
+	aggregateType string
+	id            string
+	revision      string
+	project       bool
+	snapshot      bool
+	dryRun        bool
+	raw           bool
+	concurrency   int
+}
+
+func replay(ctx context.Context, cli *builder.Client, args []string, stderr io.Writer, rebuild bool) error {
+	name := "replay"
+	if rebuild {
+		name = "rebuild"
+	}
+
+	opts := replayOptions{}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.aggregateType, "type", "", "aggregate type to replay, all wired aggregates when empty")
+	flags.StringVar(&opts.id, "id", "", "aggregate ID to replay, requires -type")
+	flags.StringVar(&opts.revision, "revision", "", "snapshot revision to write")
+	flags.BoolVar(&opts.project, "project", rebuild, "save the aggregate projections")
+	flags.BoolVar(&opts.snapshot, "snapshot", rebuild, "save snapshots for the revision")
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "replay without writing anything")
+	flags.BoolVar(&opts.raw, "raw", len(cli.Aggregates) == 0, "only check the stored streams replay, without the wired aggregates")
+	flags.IntVar(&opts.concurrency, "concurrency", 1, "number of aggregates replayed at once")
+	ctx, err := parseFlags(ctx, flags, args)
+	if err != nil {
+		return err
+	}
+
+	if len(opts.id) > 0 && len(opts.aggregateType) == 0 {
+		return fmt.Errorf("-id requires -type")
+	}
+	if rebuild && len(opts.revision) == 0 {
+		return fmt.Errorf("rebuild requires -revision")
+	}
+	if opts.raw && (rebuild || opts.project || opts.snapshot) {
+		return fmt.Errorf("-raw replays can't write projections or snapshots")
+	}
+	if opts.concurrency < 1 {
+		opts.concurrency = 1
+	}
+
+	aggregates := cli.Aggregates
+	if opts.raw {
+		var err error
+		if aggregates, err = rawAggregates(ctx, cli.DataStore, opts.aggregateType); err != nil {
+			return err
+		}
+	}
+
+	typeNames := sortedTypes(aggregates)
+	if len(opts.aggregateType) > 0 {
+		if _, ok := aggregates[opts.aggregateType]; !ok {
+			return fmt.Errorf("Aggregate %s is not wired", opts.aggregateType)
+		}
+		typeNames = []string{opts.aggregateType}
+	}
+
+	dataStore := cli.DataStore
+	if opts.dryRun || opts.raw {
+		dataStore = &readOnlyStore{dataStore}
+	}
+
+	var snapshot es.SnapshotStrategy = es.SnapshotNever()
+	if opts.snapshot {
+		snapshot = &replaySnapshot{}
+	}
+
+	failed := 0
+	for _, typeName := range typeNames {
+		ids := []string{opts.id}
+		if len(opts.id) == 0 {
+			streams, ok := es.AsStore[es.StreamStore](cli.DataStore)
+			if !ok {
+				return es.ErrStreamStoreNotSupported
+			}
+
+			var err error
+			if ids, err = streams.AggregateIDs(ctx, typeName); err != nil {
+				return err
+			}
+		}
+
+		handler := es.NewAggregateHandler(aggregates[typeName], dataStore, cli.EventBus, opts.revision, snapshot, opts.project)
+		failed = failed + replayAll(ctx, handler, typeName, ids, opts.concurrency, stderr)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d aggregates failed to %s", failed, name)
+	}
+	return nil
+}
+
+func replayAll(ctx context.Context, handler es.CommandHandler, typeName string, ids []string, concurrency int, stderr io.Writer) int {
+	p := &progress{
+		out:      stderr,
+		typeName: typeName,
+		total:    len(ids),
+	}
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range work {
+				cmd := &es.ReplayCommand{
+					BaseCommand: es.BaseCommand{AggregateID: id},
+				}
+				p.done(id, handler.HandleCommand(ctx, cmd))
+			}
+		}()
+	}
+
+	for _, id := range ids {
+		work <- id
+	}
+	close(work)
+	wg.Wait()
+
+	p.report()
+	return p.failed
+}
+
+type progress struct {
+	sync.Mutex
+
+	out      io.Writer
+	typeName string
+	total    int
+	replayed int
+	failed   int
+}
+
+func (p *progress) done(id string, err error) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.replayed = p.replayed + 1
+	if err != nil {
+		p.failed = p.failed + 1
+		fmt.Fprintf(p.out, "%s %s: %v\n", p.typeName, id, err)
+	}
+	if p.replayed%progressEvery == 0 && p.replayed < p.total {
+		fmt.Fprintf(p.out, "%s: %d/%d replayed, %d failed\n", p.typeName, p.replayed, p.total, p.failed)
+	}
+}
+
+func (p *progress) report() {
+	fmt.Fprintf(p.out, "%s: %d/%d replayed, %d failed\n", p.typeName, p.replayed, p.total, p.failed)
+}
+
+// replaySnapshot ignores existing snapshots and always saves a new one
+type replaySnapshot struct{}
+
+func (s *replaySnapshot) ShouldLoad() bool {
+	return false
+}
+func (s *replaySnapshot) ShouldSave(info es.SnapshotInfo) bool {
+	return info.Aggregate.GetVersion() > 0
+}
+
+// readOnlyStore drops every write so replays can be dry-run, the stores
+// underneath are only reached for reads
+type readOnlyStore struct {
+	es.DataStore
+}
+
+// Unwrap returns the store the reads go to, every write capability is
+// implemented here so none is found below
+func (s *readOnlyStore) Unwrap() es.DataStore {
+	return s.DataStore
+}
+
+func (s *readOnlyStore) SaveEvents(context.Context, []*es.Event, int) error {
+	return nil
+}
+func (s *readOnlyStore) SaveSnapshot(context.Context, string, es.Aggregate) error {
+	return nil
+}
+func (s *readOnlyStore) SaveAggregate(context.Context, es.Aggregate) error {
+	return nil
+}
+func (s *readOnlyStore) DeleteAggregate(context.Context, es.Aggregate) error {
+	return nil
+}
+func (s *readOnlyStore) ArchiveEvents(context.Context, string, string, int) (int, error) {
+	return 0, nil
+}
+func (s *readOnlyStore) SnapshotRevisions(ctx context.Context) ([]string, error) {
+	store, ok := es.AsStore[es.SnapshotStore](s.DataStore)
+	if !ok {
+		return nil, es.ErrSnapshotStoreNotSupported
+	}
+	return store.SnapshotRevisions(ctx)
+}
+func (s *readOnlyStore) ListSnapshots(ctx context.Context, revision string) ([]*es.SnapshotRecord, error) {
+	store, ok := es.AsStore[es.SnapshotStore](s.DataStore)
+	if !ok {
+		return nil, es.ErrSnapshotStoreNotSupported
+	}
+	return store.ListSnapshots(ctx, revision)
+}
+func (s *readOnlyStore) DeleteSnapshots(context.Context, string) error {
+	return nil
+}
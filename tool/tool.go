@@ -0,0 +1,95 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/contextgg/go-es/builder"
+	"github.com/contextgg/go-es/es"
+)
+
+const usage = `Usage: es-tool <command> [flags]
+
+Commands:
+  replay   replay aggregates against the datastore
+  rebuild  rebuild projections and snapshots for a revision
+  dump     write the events of a stream as JSON
+  export   write streams as newline-delimited JSON
+  import   read newline-delimited JSON streams into the datastore
+  archive  move the events covered by snapshots to the archive
+
+Run 'es-tool <command> -h' for the flags of a command.
+`
+
+// ErrUnknownCommand when the command isn't supported by the tool
+var ErrUnknownCommand = errors.New("Unknown command")
+
+// Main builds the client and runs the tool using the process arguments, it's
+// meant to be called from a main package that wired its aggregates
+func Main(b builder.ClientBuilder) {
+	cli, err := b.Build()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	err = Run(context.Background(), cli, os.Args[1:], os.Stdout, os.Stderr)
+	cli.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Run executes a tool command against the client
+func Run(ctx context.Context, cli *builder.Client, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return ErrUnknownCommand
+	}
+
+	switch args[0] {
+	case "replay":
+		return replay(ctx, cli, args[1:], stderr, false)
+	case "rebuild":
+		return replay(ctx, cli, args[1:], stderr, true)
+	case "dump":
+		return dump(ctx, cli, args[1:], stdout, stderr)
+	case "export":
+		return export(ctx, cli, args[1:], stdout, stderr)
+	case "import":
+		return importEvents(ctx, cli, args[1:], os.Stdin, stderr)
+	case "archive":
+		return archive(ctx, cli, args[1:], stderr)
+	default:
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("%w: %s", ErrUnknownCommand, args[0])
+	}
+}
+
+// parseFlags adds the flags every command has and parses args, the context
+// returned is for the tenant given with -tenant
+func parseFlags(ctx context.Context, flags *flag.FlagSet, args []string) (context.Context, error) {
+	tenant := flags.String("tenant", "", "tenant to work on, the data without a tenant when empty")
+	if err := flags.Parse(args); err != nil {
+		return ctx, err
+	}
+	if len(*tenant) > 0 {
+		ctx = es.WithTenant(ctx, *tenant)
+	}
+	return ctx, nil
+}
+
+func sortedTypes(aggregates map[string]es.AggregateSourcedFactory) []string {
+	typeNames := []string{}
+	for name := range aggregates {
+		typeNames = append(typeNames, name)
+	}
+	sort.Strings(typeNames)
+	return typeNames
+}
@@ -0,0 +1,223 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/contextgg/go-es/builder"
+	"github.com/contextgg/go-es/es"
+)
+
+type LoggedIn struct {
+	Username string
+}
+
+// Auth aggregate
+type Auth struct {
+	es.BaseAggregateSourced
+
+	Username string `bson:"username"`
+}
+
+func (a *Auth) HandleCommand(ctx context.Context, cmd es.Command) error {
+	if c, ok := cmd.(*Login); ok {
+		a.StoreEvent(&LoggedIn{Username: c.Username})
+	}
+	return nil
+}
+func (a *Auth) ApplyEvent(ctx context.Context, event interface{}) error {
+	if e, ok := event.(*LoggedIn); ok {
+		a.Username = e.Username
+	}
+	return nil
+}
+
+// Login is a command
+type Login struct {
+	es.BaseCommand
+
+	Username string
+}
+
+func newClient(t *testing.T) *builder.Client {
+	b, err := builder.NewClientBuilder(builder.LocalStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.RegisterEvents(builder.Event(&LoggedIn{}, false))
+	b.WireAggregate(builder.Aggregate(&Auth{}), builder.Command(&Login{}))
+
+	cli, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"1", "2", "3"} {
+		cmd := &Login{BaseCommand: es.BaseCommand{AggregateID: id}, Username: "user" + id}
+		if err := cli.CommandBus.HandleCommand(context.Background(), cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cli
+}
+
+func TestRebuild(t *testing.T) {
+	cli := newClient(t)
+	ctx := context.Background()
+
+	var stderr bytes.Buffer
+	args := []string{"rebuild", "-revision", "v2", "-concurrency", "2"}
+	if err := Run(ctx, cli, args, &bytes.Buffer{}, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stderr.String(), "Auth: 3/3 replayed, 0 failed\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, id := range []string{"1", "2", "3"} {
+		aggregate := &Auth{}
+		aggregate.Initialize(id, "Auth")
+		if err := cli.DataStore.LoadSnapshot(ctx, "v2", aggregate); err != nil {
+			t.Fatal(err)
+		}
+		if aggregate.Username != "user"+id || aggregate.GetVersion() != 1 {
+			t.Errorf("snapshot %s not rebuilt: %+v", id, aggregate)
+		}
+	}
+}
+
+func TestRebuildDryRun(t *testing.T) {
+	cli := newClient(t)
+	ctx := context.Background()
+
+	args := []string{"rebuild", "-revision", "v2", "-type", "Auth", "-id", "1", "-dry-run"}
+	if err := Run(ctx, cli, args, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	aggregate := &Auth{}
+	aggregate.Initialize("1", "Auth")
+	if err := cli.DataStore.LoadSnapshot(ctx, "v2", aggregate); err != nil {
+		t.Fatal(err)
+	}
+	if aggregate.GetVersion() != 0 {
+		t.Errorf("dry-run wrote a snapshot: %+v", aggregate)
+	}
+}
+
+func TestReplayRaw(t *testing.T) {
+	cli := newClient(t)
+	ctx := context.Background()
+
+	var stderr bytes.Buffer
+	if err := Run(ctx, cli, []string{"replay", "-raw"}, &bytes.Buffer{}, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stderr.String(), "Auth: 3/3 replayed, 0 failed\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// raw aggregates have no state worth writing
+	if err := Run(ctx, cli, []string{"rebuild", "-raw", "-revision", "v2"}, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("expected a raw rebuild to fail")
+	}
+}
+
+func TestReadOnlyStore(t *testing.T) {
+	cli := newClient(t)
+	store := &readOnlyStore{cli.DataStore}
+
+	// reads reach the store underneath
+	if _, ok := es.AsStore[es.StreamStore](store); !ok {
+		t.Error("expected the stream store to be found")
+	}
+
+	// writes never do
+	if deleter, _ := es.AsStore[es.AggregateDeleter](store); deleter != store {
+		t.Errorf("got deleter %T", deleter)
+	}
+	if archive, _ := es.AsStore[es.ArchiveStore](store); archive != store {
+		t.Errorf("got archive store %T", archive)
+	}
+	if snapshots, _ := es.AsStore[es.SnapshotStore](store); snapshots != store {
+		t.Errorf("got snapshot store %T", snapshots)
+	}
+}
+
+func TestDump(t *testing.T) {
+	cli := newClient(t)
+
+	var stdout bytes.Buffer
+	args := []string{"dump", "-type", "Auth", "-id", "2"}
+	if err := Run(context.Background(), cli, args, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []map[string]interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0]["type"] != "LoggedIn" {
+		t.Errorf("unexpected dump: %s", stdout.String())
+	}
+}
+
+func TestDumpTenant(t *testing.T) {
+	cli := newClient(t)
+	ctx := context.Background()
+
+	cmd := &Login{BaseCommand: es.BaseCommand{AggregateID: "4"}, Username: "user4"}
+	if err := cli.CommandBus.HandleCommand(es.WithTenant(ctx, "acme"), cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	for tenant, want := range map[string]int{"": 0, "acme": 1} {
+		var stdout bytes.Buffer
+		args := []string{"dump", "-tenant", tenant, "-type", "Auth", "-id", "4"}
+		if err := Run(ctx, cli, args, &stdout, &bytes.Buffer{}); err != nil {
+			t.Fatal(err)
+		}
+
+		var events []map[string]interface{}
+		if err := json.Unmarshal(stdout.Bytes(), &events); err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != want {
+			t.Errorf("tenant %q: got %d events, want %d", tenant, len(events), want)
+		}
+	}
+}
+
+func TestArchive(t *testing.T) {
+	cli := newClient(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"b", "c"} {
+		cmd := &Login{BaseCommand: es.BaseCommand{AggregateID: "1"}, Username: name}
+		if err := cli.CommandBus.HandleCommand(ctx, cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Run(ctx, cli, []string{"rebuild", "-revision", "v2"}, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	if err := Run(ctx, cli, []string{"archive", "-revision", "v2"}, &bytes.Buffer{}, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stderr.String(), "2 events archived\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	events, err := cli.DataStore.LoadEvents(ctx, "1", "Auth", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 || events[0].Version != 1 {
+		t.Errorf("archived events not loaded: %v", events)
+	}
+}